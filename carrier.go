@@ -0,0 +1,386 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// A Carrier hides a ZWC file in a message.
+// Carriers are registered by name with RegisterCarrier
+// so they can be looked up with LookupCarrier.
+// Inserting the file into the message as zero-width characters
+// isn't a Carrier since it doesn't need the whole message at once,
+// use Encoder and Decoder to stream the file instead.
+type Carrier interface {
+	// Capacity returns the number of bytes of data
+	// which can be hidden in message with enc,
+	// or -1 if there is no limit.
+	Capacity(enc *Encoding, message []byte) int
+
+	// Encode hides data encoded with enc in message.
+	// It returns a CarrierError if the data doesn't fit.
+	Encode(enc *Encoding, message, data []byte) ([]byte, error)
+
+	// Decode returns the data hidden in text
+	// and the message without the data.
+	Decode(text []byte) (data, message []byte, err error)
+}
+
+// A BitCarrier hides bits by changing the characters of a message
+// instead of inserting the encoded file into it.
+// NewBitCarrier turns a BitCarrier into a Carrier.
+type BitCarrier interface {
+	// Bits returns the number of bits which can be hidden in message
+	Bits(message []byte) int
+
+	// Embed hides bits in message.
+	// Each byte of bits is a single bit and
+	// len(bits) is never more than Bits(message).
+	Embed(message, bits []byte) []byte
+
+	// Extract returns the bits hidden in text
+	// and the message without them
+	Extract(text []byte) (bits, message []byte)
+}
+
+// NewBitCarrier returns a Carrier which
+// converts the encoded file into bits hidden by b.
+// Each delim char is a 0 bit and each other character is a 1 bit
+// followed by its value in the table, most significant bit first.
+// Values in the header use 2 bits and values in the payload and checksum
+// use as many bits as the largest value in the table.
+// Bits which aren't needed are 0, so they read as delim chars
+// and are ignored after the checksum.
+func NewBitCarrier(b BitCarrier) Carrier {
+	return bitCarrier{b}
+}
+
+type bitCarrier struct {
+	b BitCarrier
+}
+
+func (c bitCarrier) Capacity(enc *Encoding, message []byte) int {
+	return carrierCapacity(enc, c.b.Bits(message))
+}
+
+func (c bitCarrier) Encode(enc *Encoding, message, data []byte) ([]byte, error) {
+	bits, err := carrierFile(enc, data, c.b.Bits(message))
+	if err != nil {
+		return nil, err
+	}
+	return c.b.Embed(message, bits), nil
+}
+
+func (c bitCarrier) Decode(text []byte) (data, message []byte, err error) {
+	bits, message := c.b.Extract(text)
+	data, err = decodeBits(bits)
+	return data, message, err
+}
+
+// ReadText reads the whole text from r for decoding
+// which needs all of it at once, such as by a Carrier or DetectEncoding.
+// Since the file may be anywhere in the text,
+// a LimitError is returned if r is longer than opts.MaxScanBytes.
+func (opts DecoderOptions) ReadText(r io.Reader) ([]byte, error) {
+	if opts.MaxScanBytes > 0 {
+		r = io.LimitReader(r, opts.MaxScanBytes+1)
+	}
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxScanBytes > 0 && int64(len(text)) > opts.MaxScanBytes {
+		return nil, LimitError{ScanBytes: true, Limit: opts.MaxScanBytes}
+	}
+	return text, nil
+}
+
+// DecodeCarrier reads the text from r with ReadText and decodes it with c.
+// A LimitError is also returned if the data is longer than opts.MaxPayloadBytes.
+func (opts DecoderOptions) DecodeCarrier(c Carrier, r io.Reader) (data, message []byte, err error) {
+	text, err := opts.ReadText(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, message, err = c.Decode(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.MaxPayloadBytes > 0 && int64(len(data)) > opts.MaxPayloadBytes {
+		return nil, nil, LimitError{PayloadBytes: true, Limit: opts.MaxPayloadBytes}
+	}
+	return data, message, nil
+}
+
+var (
+	carrierNames []string
+	carriers     = make(map[string]Carrier)
+)
+
+func init() {
+	RegisterCarrier("whitespace", WhitespaceCarrier)
+	RegisterCarrier("spaces", SpaceCarrier)
+	RegisterCarrier("homoglyphs", HomoglyphCarrier)
+}
+
+// RegisterCarrier makes c available by name.
+// It panics if name is empty or already registered, or if c is nil.
+func RegisterCarrier(name string, c Carrier) {
+	if name == "" {
+		panic("carrier name is empty")
+	}
+	if c == nil {
+		panic("carrier " + name + " is nil")
+	}
+	if _, ok := carriers[name]; ok {
+		panic("carrier " + name + " is already registered")
+	}
+
+	carrierNames = append(carrierNames, name)
+	carriers[name] = c
+}
+
+// unregisterCarrier removes the carrier registered as name,
+// so tests can register a carrier more than once
+func unregisterCarrier(name string) {
+	carrierNames = slices.DeleteFunc(carrierNames, func(n string) bool { return n == name })
+	delete(carriers, name)
+}
+
+// LookupCarrier returns the Carrier registered as name,
+// or nil if there isn't one
+func LookupCarrier(name string) Carrier {
+	return carriers[name]
+}
+
+// CarrierNames returns the names of the registered carriers
+// in the order they were registered
+func CarrierNames() []string {
+	return slices.Clone(carrierNames)
+}
+
+type CarrierError struct {
+	Capacity   int  // bytes of data which fit in the message
+	NoCapacity bool // data doesn't fit in the message
+	NotFound   bool // message doesn't contain a file
+}
+
+func (e CarrierError) Error() string {
+	msg := "carrier: "
+
+	switch {
+	case e.NoCapacity:
+		msg += "message can only hold " + strconv.Itoa(e.Capacity) + " bytes of data"
+	case e.NotFound:
+		msg += ErrNotFound.Error()
+	}
+
+	return msg
+}
+
+// valueBits returns the number of bits needed
+// for the values of a table with n characters
+func valueBits(n int) int {
+	var width int
+	for ; 1<<width < n; width++ {
+	}
+	return width
+}
+
+// fileBits converts a file encoded with enc into bits,
+// one bit per byte of the returned slice
+func fileBits(enc *Encoding, file []byte) []byte {
+	var bits []byte
+	var delims int
+
+	for _, r := range string(file) {
+		if r == enc.delimChar {
+			bits = append(bits, 0)
+			delims++
+			continue
+		}
+
+		// characters which aren't in the table, such as a terminator,
+		// aren't needed to decode the file
+		v, ok := enc.decodeMap.lookup(r)
+		if !ok {
+			continue
+		}
+
+		width := 2 // the header always uses 2-bit encoding
+		if delims >= 2 {
+			width = valueBits(len(enc.encode))
+		}
+
+		bits = append(bits, 1)
+		for i := width - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1)
+		}
+	}
+
+	return bits
+}
+
+// fileBitsLen returns the number of bits
+// needed to hide n bytes of data with enc
+func fileBitsLen(enc *Encoding, n int) int {
+	width := 1 + valueBits(len(enc.encode))
+	chars := enc.encodedChars(n) + enc.encodedChars(enc.checksumType/8)
+
+	// 3 delim chars and a header of 4 characters per version
+	return 3 + 3*4*enc.version + width*chars
+}
+
+// carrierCapacity returns the largest number of bytes of data
+// which can be hidden with enc in a carrier which holds nBits bits
+func carrierCapacity(enc *Encoding, nBits int) int {
+	if fileBitsLen(enc, 0) > nBits {
+		return 0
+	}
+
+	// every byte needs at least 1 bit
+	lo, hi := 0, nBits
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fileBitsLen(enc, mid) <= nBits {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo
+}
+
+// carrierFile encodes data with enc and converts it into bits
+// which must fit in a carrier which holds nBits bits
+func carrierFile(enc *Encoding, data []byte, nBits int) ([]byte, error) {
+	if fileBitsLen(enc, len(data)) > nBits {
+		return nil, CarrierError{NoCapacity: true, Capacity: carrierCapacity(enc, nBits)}
+	}
+
+	file := make([]byte, enc.EncodedMaxLen(len(data)))
+	file = file[:enc.Encode(file, data)]
+	return fileBits(enc, file), nil
+}
+
+// fileFromBits converts bits back into an encoded file.
+// The header is decoded to find the Encoding of the rest of the file.
+func fileFromBits(bits []byte) ([]byte, error) {
+	// readValue reads a 1 bit followed by width bits.
+	// ok is false if the next bit is 0 or there aren't enough bits.
+	readValue := func(width int) (v byte, ok bool) {
+		if len(bits) < 1+width || bits[0] == 0 {
+			return 0, false
+		}
+		for _, b := range bits[1 : 1+width] {
+			v = v<<1 | b
+		}
+		bits = bits[1+width:]
+		return v, true
+	}
+	// readDelim reads a 0 bit
+	readDelim := func() bool {
+		if len(bits) == 0 || bits[0] != 0 {
+			return false
+		}
+		bits = bits[1:]
+		return true
+	}
+
+	if !readDelim() {
+		return nil, CarrierError{NotFound: true}
+	}
+
+	// the header is decoded with V1Table
+	// because it only contains values
+	var header []byte
+	for v, ok := readValue(2); ok; v, ok = readValue(2) {
+		header = append(header, V1Table[v]...)
+	}
+	if !readDelim() {
+		return nil, CarrierError{NotFound: true}
+	}
+
+	v, e, c, profile, err := decodeHeader(V1Table[:], header)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := headerEncoding(profile, v, e, c)
+	if err != nil {
+		return nil, err
+	}
+
+	// the header is encoded again with the table of enc
+	delimChar := enc.DelimCharAsUTF8()
+	encodedHeader := make([]byte, enc.EncodedHeaderLen())
+	var file bytes.Buffer
+	file.Write(delimChar)
+	file.Write(encodedHeader[:enc.EncodeHeader(encodedHeader)])
+	file.Write(delimChar)
+
+	// payload, delim, and checksum
+	width := valueBits(len(enc.encode))
+	for delims := 2; delims < 4; {
+		if v, ok := readValue(width); ok {
+			file.WriteString(enc.encode[v])
+		} else if readDelim() {
+			delims++
+			if delims < 4 {
+				file.Write(delimChar)
+			}
+		} else {
+			break
+		}
+	}
+
+	return file.Bytes(), nil
+}
+
+// decodeBits decodes the file in bits extracted by a carrier
+func decodeBits(bits []byte) ([]byte, error) {
+	file, err := fileFromBits(bits)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(NewDecoder(bytes.NewReader(file)))
+}
+
+// lines splits text after each newline
+func lines(text []byte) [][]byte {
+	lines := bytes.SplitAfter(text, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineEnd splits line into its contents and its line ending
+func lineEnd(line []byte) (contents, end []byte) {
+	switch {
+	case bytes.HasSuffix(line, []byte("\r\n")):
+		return line[:len(line)-2], line[len(line)-2:]
+	case bytes.HasSuffix(line, []byte("\n")):
+		return line[:len(line)-1], line[len(line)-1:]
+	}
+	return line, nil
+}
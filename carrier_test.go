@@ -0,0 +1,164 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc_test
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yadayadajaychan/zwc"
+)
+
+// noBreakSpace is a BitCarrier which hides bits in the spaces of a message.
+// A space is a 0 bit and a no-break space is a 1 bit.
+type noBreakSpace struct{}
+
+func (noBreakSpace) Bits(message []byte) int {
+	return bytes.Count(message, []byte(" "))
+}
+
+func (noBreakSpace) Embed(message, bits []byte) []byte {
+	var text []byte
+	for _, c := range message {
+		if c == ' ' && len(bits) > 0 {
+			if bits[0] == 1 {
+				text = append(text, "\u00A0"...)
+			} else {
+				text = append(text, ' ')
+			}
+			bits = bits[1:]
+		} else {
+			text = append(text, c)
+		}
+	}
+	return text
+}
+
+func (noBreakSpace) Extract(text []byte) (bits, message []byte) {
+	for _, r := range string(text) {
+		switch r {
+		case ' ':
+			bits = append(bits, 0)
+			message = append(message, ' ')
+		case '\u00A0':
+			bits = append(bits, 1)
+			message = append(message, ' ')
+		default:
+			message = append(message, string(r)...)
+		}
+	}
+	return bits, message
+}
+
+// TestRegisterCarrier tests that a third party carrier
+// can be registered and looked up
+func TestRegisterCarrier(t *testing.T) {
+	c := zwc.NewBitCarrier(noBreakSpace{})
+	zwc.RegisterCarrier("no-break-space", c)
+	t.Cleanup(func() { zwc.UnregisterCarrier("no-break-space") })
+
+	if zwc.LookupCarrier("no-break-space") != c {
+		t.Error("LookupCarrier didn't return the registered carrier")
+	}
+	names := zwc.CarrierNames()
+	if names[len(names)-1] != "no-break-space" {
+		t.Error("Expected no-break-space to be the last carrier, got", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic for carrier which is already registered")
+		}
+	}()
+	zwc.RegisterCarrier("whitespace", c)
+}
+
+// TestCarriers tests that every registered carrier
+// can hide data in a message with each encoding and restore it,
+// respects its capacity, and returns an error if there is no data
+func TestCarriers(t *testing.T) {
+	message := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 40))
+	data := []byte("hidden")
+
+	encodings := []*zwc.Encoding{
+		zwc.NewEncoding(1, 2, 16),
+		zwc.NewEncoding(1, 4, 32),
+		zwc.NewEncoding(2, 5, 8),
+		zwc.NewBidiSafeEncoding(3, 0),
+		zwc.NewTagEncoding(16),
+	}
+
+	names := zwc.CarrierNames()
+	for _, name := range []string{"whitespace", "spaces", "homoglyphs"} {
+		if !slices.Contains(names, name) {
+			t.Error("carrier", name, "isn't registered")
+		}
+	}
+
+	for _, name := range names {
+		c := zwc.LookupCarrier(name)
+		if c == nil {
+			t.Error("LookupCarrier returned nil for", name)
+			continue
+		}
+
+		for i, enc := range encodings {
+			text, err := c.Encode(enc, message, data)
+			if err != nil {
+				t.Errorf("carrier %v, encoding %v: Encode returned an error of %v", name, i, err)
+				continue
+			}
+
+			decoded, m, err := c.Decode(text)
+			if err != nil {
+				t.Errorf("carrier %v, encoding %v: Decode returned an error of %v", name, i, err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Errorf("carrier %v, encoding %v: Expected %q, got %q", name, i, data, decoded)
+			}
+			if !bytes.Equal(m, message) {
+				t.Errorf("carrier %v, encoding %v: Expected %q, got %q", name, i, message, m)
+			}
+		}
+
+		// exactly capacity bytes fit in the message
+		enc := encodings[0]
+		if capacity := c.Capacity(enc, message); capacity != -1 {
+			if capacity < len(data) {
+				t.Errorf("carrier %v: Expected capacity of at least %v, got %v", name, len(data), capacity)
+			}
+			if _, err := c.Encode(enc, message, make([]byte, capacity)); err != nil {
+				t.Errorf("carrier %v: Encode returned an error of %v", name, err)
+			}
+			_, err := c.Encode(enc, message, make([]byte, capacity+1))
+			if v, ok := err.(zwc.CarrierError); !ok || !v.NoCapacity || v.Capacity != capacity {
+				t.Errorf("carrier %v: Expected capacity error, got %v", name, err)
+			}
+		}
+
+		// no data is hidden in the message
+		if _, _, err := c.Decode(message); err == nil {
+			t.Errorf("carrier %v: Expected error for message without data", name)
+		}
+	}
+
+	if zwc.LookupCarrier("unknown") != nil {
+		t.Error("Expected nil for unknown carrier")
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// Sentinel errors which can be compared with errors.Is.
+// Each error type of this package matches the sentinel for its kind
+// as well as the sentinel for its type, such as ErrCorruptPayload.
+var (
+	ErrCorruptHeader   = errors.New("corrupt header")
+	ErrCorruptPayload  = errors.New("corrupt payload")
+	ErrInvalidEncoding = errors.New("invalid encoding")
+	ErrInvalidAlphabet = errors.New("invalid alphabet")
+	ErrCarrier         = errors.New("carrier")
+	ErrLimit           = errors.New("limit exceeded")
+
+	// CorruptHeaderError
+	ErrShortHeader       = errors.New("header shorter than expected")
+	ErrHeaderCRCMismatch = errors.New("crc for header failed")
+
+	// CorruptPayloadError
+	ErrInvalidUTF8     = errors.New("payload contains non-valid UTF-8")
+	ErrIncompleteByte  = errors.New("payload contains incomplete byte")
+	ErrShortCRC        = errors.New("crc is too short")
+	ErrCRCMismatch     = errors.New("crc for payload failed")
+	ErrMissingDelim    = errors.New("missing delim char")
+	ErrUnexpectedDelim = errors.New("unexpected delim char")
+	ErrNonZeroPadding  = errors.New("padding at end of payload isn't zero")
+	ErrChunkOverflow   = errors.New("chunk is too large for its length")
+
+	// InvalidEncodingError
+	ErrInvalidVersion      = errors.New("only ZWC file format versions 1 and 2 are supported")
+	ErrInvalidEncodingType = errors.New("encodingType must be either 0, 2, 3, 4, 5, 6, or 8")
+	ErrInvalidChecksumType = errors.New("checksumType must be either 0, 8, 16, or 32")
+	ErrInvalidProfile      = errors.New("unknown profile")
+	ErrVersionMismatch     = errors.New("encodingType requires version 2")
+	ErrUnsupportedTable    = errors.New("table has an unsupported length for encodingType")
+
+	// InvalidAlphabetError
+	ErrInvalidDelim  = errors.New("delimChar is illegal rune")
+	ErrInvalidChar   = errors.New("invalid character in table")
+	ErrMissingChar   = errors.New("missing character in table")
+	ErrDuplicateChar = errors.New("duplicate character in table")
+	ErrDelimOverlap  = errors.New("character in table is same as delimChar")
+
+	// CarrierError
+	ErrNoCapacity = errors.New("message can't hold the data")
+	ErrNotFound   = errors.New("no file found in message")
+
+	// LimitError
+	ErrMaxPayloadBytes = errors.New("data is too long")
+	ErrMaxScanBytes    = errors.New("file signature not found")
+	ErrMaxFiles        = errors.New("too many files")
+)
+
+func (e CorruptHeaderError) kind() error {
+	expectedLength := 8
+	if e.ExpectedLength != 0 {
+		expectedLength = e.ExpectedLength
+	}
+
+	switch {
+	case e.HeaderLength < expectedLength:
+		return ErrShortHeader
+	case e.CRCFail:
+		return ErrHeaderCRCMismatch
+	}
+	return nil
+}
+
+func (e CorruptHeaderError) Is(target error) bool {
+	return target == ErrCorruptHeader || target != nil && target == e.kind()
+}
+
+func (e CorruptPayloadError) kind() error {
+	switch {
+	case e.NotValidUTF8:
+		return ErrInvalidUTF8
+	case e.IncompleteByte:
+		return ErrIncompleteByte
+	case e.ShortCRC:
+		return ErrShortCRC
+	case e.CRCFail:
+		return ErrCRCMismatch
+	case e.NoDelimChar:
+		return ErrMissingDelim
+	case e.UnexpectedDelimChar:
+		return ErrUnexpectedDelim
+	case e.NonZeroPadding:
+		return ErrNonZeroPadding
+	case e.ChunkOverflow:
+		return ErrChunkOverflow
+	}
+	return nil
+}
+
+func (e CorruptPayloadError) Is(target error) bool {
+	return target == ErrCorruptPayload || target != nil && target == e.kind()
+}
+
+func (e InvalidEncodingError) kind() error {
+	switch {
+	case e.InvalidVersion:
+		return ErrInvalidVersion
+	case e.InvalidEncodingType:
+		return ErrInvalidEncodingType
+	case e.InvalidChecksumType:
+		return ErrInvalidChecksumType
+	case e.InvalidProfile:
+		return ErrInvalidProfile
+	case e.VersionMismatch:
+		return ErrVersionMismatch
+	case e.UnsupportedTable:
+		return ErrUnsupportedTable
+	case e.InvalidAlphabet:
+		return ErrInvalidAlphabet
+	}
+	return nil
+}
+
+func (e InvalidEncodingError) Is(target error) bool {
+	return target == ErrInvalidEncoding || target != nil && target == e.kind()
+}
+
+// Unwrap returns the errors from ValidAlphabet if e.InvalidAlphabet is set
+func (e InvalidEncodingError) Unwrap() error {
+	return e.alphabetErr
+}
+
+func (e InvalidAlphabetError) kind() error {
+	switch {
+	case e.InvalidDelim:
+		return ErrInvalidDelim
+	case e.InvalidChar:
+		return ErrInvalidChar
+	case e.Missing:
+		return ErrMissingChar
+	case e.Duplicate:
+		return ErrDuplicateChar
+	case e.DelimOverlap:
+		return ErrDelimOverlap
+	}
+	return nil
+}
+
+func (e InvalidAlphabetError) Is(target error) bool {
+	return target == ErrInvalidAlphabet || target != nil && target == e.kind()
+}
+
+func (e CarrierError) kind() error {
+	switch {
+	case e.NoCapacity:
+		return ErrNoCapacity
+	case e.NotFound:
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (e CarrierError) Is(target error) bool {
+	return target == ErrCarrier || target != nil && target == e.kind()
+}
+
+func (e LimitError) kind() error {
+	switch {
+	case e.PayloadBytes:
+		return ErrMaxPayloadBytes
+	case e.ScanBytes:
+		return ErrMaxScanBytes
+	case e.Files:
+		return ErrMaxFiles
+	}
+	return nil
+}
+
+func (e LimitError) Is(target error) bool {
+	return target == ErrLimit || target != nil && target == e.kind()
+}
+
+// errorAt adds the position of src[:i] to the offsets of err
+// if it is a CorruptHeaderError or CorruptPayloadError
+func errorAt(err error, src []byte, i int) error {
+	return moveError(err, i, utf8.RuneCount(src[:i]))
+}
+
+// moveError adds offset and runeOffset to the offsets of err
+// if it is a CorruptHeaderError or CorruptPayloadError
+func moveError(err error, offset, runeOffset int) error {
+	switch v := err.(type) {
+	case CorruptHeaderError:
+		v.Offset += offset
+		v.RuneOffset += runeOffset
+		return v
+	case CorruptPayloadError:
+		v.Offset += offset
+		v.RuneOffset += runeOffset
+		return v
+	}
+	return err
+}
+
+// runeCount returns the number of characters in p without
+// converting it to a string like utf8.RuneCount.
+// Every character of valid UTF-8 has one byte which isn't a continuation byte.
+// Invalid UTF-8 may be counted differently from utf8.RuneCount.
+func runeCount(p []byte) (n int) {
+	for _, b := range p {
+		if b&0xC0 != 0x80 {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,20 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+// UnregisterCarrier removes a carrier registered by a test
+var UnregisterCarrier = unregisterCarrier
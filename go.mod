@@ -6,6 +6,7 @@ require (
 	github.com/snksoft/crc v1.1.0
 	github.com/spf13/cobra v1.7.0
 	golang.org/x/term v0.11.0
+	golang.org/x/text v0.12.0
 )
 
 require (
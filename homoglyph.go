@@ -0,0 +1,121 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// Homoglyphs maps the Latin letters which can hide a bit
+// to a Cyrillic or Greek letter which looks the same
+var Homoglyphs = map[rune]rune{
+	'a': 'а', // CYRILLIC SMALL LETTER A
+	'c': 'с', // CYRILLIC SMALL LETTER ES
+	'e': 'е', // CYRILLIC SMALL LETTER IE
+	'i': 'і', // CYRILLIC SMALL LETTER BYELORUSSIAN-UKRAINIAN I
+	'j': 'ј', // CYRILLIC SMALL LETTER JE
+	'o': 'о', // CYRILLIC SMALL LETTER O
+	'p': 'р', // CYRILLIC SMALL LETTER ER
+	's': 'ѕ', // CYRILLIC SMALL LETTER DZE
+	'x': 'х', // CYRILLIC SMALL LETTER HA
+	'y': 'у', // CYRILLIC SMALL LETTER U
+	'A': 'А', // CYRILLIC CAPITAL LETTER A
+	'B': 'В', // CYRILLIC CAPITAL LETTER VE
+	'C': 'С', // CYRILLIC CAPITAL LETTER ES
+	'E': 'Е', // CYRILLIC CAPITAL LETTER IE
+	'H': 'Н', // CYRILLIC CAPITAL LETTER EN
+	'I': 'І', // CYRILLIC CAPITAL LETTER BYELORUSSIAN-UKRAINIAN I
+	'J': 'Ј', // CYRILLIC CAPITAL LETTER JE
+	'K': 'К', // CYRILLIC CAPITAL LETTER KA
+	'M': 'М', // CYRILLIC CAPITAL LETTER EM
+	'N': 'Ν', // GREEK CAPITAL LETTER NU
+	'O': 'О', // CYRILLIC CAPITAL LETTER O
+	'P': 'Р', // CYRILLIC CAPITAL LETTER ER
+	'S': 'Ѕ', // CYRILLIC CAPITAL LETTER DZE
+	'T': 'Т', // CYRILLIC CAPITAL LETTER TE
+	'X': 'Х', // CYRILLIC CAPITAL LETTER HA
+	'Y': 'Υ', // GREEK CAPITAL LETTER UPSILON
+	'Z': 'Ζ', // GREEK CAPITAL LETTER ZETA
+}
+
+// latinLetters maps each homoglyph back to its Latin letter
+var latinLetters = func() map[rune]rune {
+	m := make(map[rune]rune, len(Homoglyphs))
+	for latin, homoglyph := range Homoglyphs {
+		m[homoglyph] = latin
+	}
+	return m
+}()
+
+// HomoglyphCarrier hides data by replacing the letters of the message
+// with their homoglyphs in Homoglyphs.
+// A Latin letter is a 0 bit and its homoglyph is a 1 bit.
+var HomoglyphCarrier = NewBitCarrier(homoglyphs{})
+
+type homoglyphs struct{}
+
+// Bits returns the number of letters in message which have a homoglyph
+func (homoglyphs) Bits(message []byte) int {
+	var n int
+	for _, r := range string(message) {
+		if _, ok := Homoglyphs[r]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+func (homoglyphs) Embed(message, bits []byte) []byte {
+	var text bytes.Buffer
+	for len(message) > 0 {
+		r, size := utf8.DecodeRune(message)
+		if homoglyph, ok := Homoglyphs[r]; ok && len(bits) > 0 {
+			if bits[0] == 1 {
+				text.WriteRune(homoglyph)
+			} else {
+				text.WriteRune(r)
+			}
+			bits = bits[1:]
+		} else {
+			text.Write(message[:size])
+		}
+		message = message[size:]
+	}
+
+	return text.Bytes()
+}
+
+// Extract replaces every homoglyph with its Latin letter
+func (homoglyphs) Extract(text []byte) (bits, message []byte) {
+	var m bytes.Buffer
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		if latin, ok := latinLetters[r]; ok {
+			bits = append(bits, 1)
+			m.WriteRune(latin)
+		} else {
+			if _, ok := Homoglyphs[r]; ok {
+				bits = append(bits, 0)
+			}
+			m.Write(text[:size])
+		}
+		text = text[size:]
+	}
+
+	return bits, m.Bytes()
+}
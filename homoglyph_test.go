@@ -0,0 +1,55 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yadayadajaychan/zwc"
+)
+
+// TestHomoglyphs tests that data is only hidden
+// by replacing letters with their homoglyphs
+func TestHomoglyphs(t *testing.T) {
+	message := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 40))
+	data := []byte("hidden")
+
+	var homoglyphs []rune
+	for _, r := range zwc.Homoglyphs {
+		homoglyphs = append(homoglyphs, r)
+	}
+
+	text, err := zwc.HomoglyphCarrier.Encode(zwc.NewEncoding(1, 2, 16), message, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(text, message) {
+		t.Error("no letters were replaced")
+	}
+	for _, r := range string(text) {
+		if r > 0x7f && !strings.ContainsRune(string(homoglyphs), r) {
+			t.Errorf("unexpected character %q", r)
+			break
+		}
+	}
+	if n := len([]rune(string(text))); n != len(message) {
+		t.Errorf("Expected %v characters, got %v", len(message), n)
+	}
+}
@@ -0,0 +1,451 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/yadayadajaychan/zwc"
+	"golang.org/x/text/unicode/bidi"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/unicode/runenames"
+)
+
+// alphabetCmd represents the alphabet command
+var alphabetCmd = &cobra.Command{
+	Use:     "alphabet",
+	Short:   "Work with alphabet files",
+	Aliases: []string{"a", "al", "alp", "alph", "alpha", "alphab", "alphabe"},
+}
+
+// alphabetCheckCmd represents the alphabet check command
+var alphabetCheckCmd = &cobra.Command{
+	Use:   "check FILE",
+	Short: "Check the characters in an alphabet file",
+	Long: `Check that the characters in an alphabet file can be used for encoding
+and warn about characters which may be visible or change how the message is
+displayed.`,
+	Aliases: []string{"c", "ch", "che", "chec"},
+	Args:    cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		quiet, err := cmd.Flags().GetBool("quiet")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading quiet flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
+		a, err := loadAlphabet(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(1)
+		}
+
+		delimErrs, errs := alphabetErrors(a)
+
+		var nErrs, nWarnings int
+		report := func(r rune, errs []string) {
+			warnings := lintChar(r)
+			if quiet {
+				warnings = nil
+			}
+			nErrs += len(errs)
+			nWarnings += len(warnings)
+
+			for _, e := range errs {
+				fmt.Println("      error:", e)
+			}
+			for _, w := range warnings {
+				fmt.Println("      warning:", w)
+			}
+		}
+
+		fmt.Printf("delim %v\n", describeChar(a.delim))
+		report(a.delim, delimErrs)
+
+		for i, v := range a.table[:a.size] {
+			r, _ := utf8.DecodeRuneInString(v)
+			fmt.Printf("%5v %v\n", i, describeChar(r))
+			report(r, errs[i])
+		}
+
+		fmt.Println()
+		for _, e := range []int{2, 3, 4, 5, 6, 8} {
+			if e > a.maxEncodingType() {
+				break
+			}
+
+			maxUTF8, maxUTF16 := alphabetCost(a.table[:1<<e])
+			charsPerByte := float64((8 + e - 1) / e)
+			switch e {
+			case 5:
+				charsPerByte = 8.0 / 5 // 5 bytes are packed into 8 characters
+			case 6:
+				charsPerByte = 4.0 / 3 // 3 bytes are packed into 4 characters
+			}
+			fmt.Printf("encoding %v: up to %v bytes of utf-8 or %v utf-16 code units per byte of data\n",
+				e, charsPerByte*float64(maxUTF8), charsPerByte*float64(maxUTF16))
+		}
+
+		// base-N encoding uses every character in chunks of 8 bytes
+		maxUTF8, maxUTF16 := alphabetCost(a.table)
+		charsPerByte := math.Ceil(64/math.Log2(float64(a.size))) / 8
+		fmt.Printf("encoding 0 (base %v): up to %v bytes of utf-8 or %v utf-16 code units per byte of data\n",
+			a.size, charsPerByte*float64(maxUTF8), charsPerByte*float64(maxUTF16))
+		fmt.Printf("%v error(s), %v warning(s)\n", nErrs, nWarnings)
+
+		if nErrs > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(alphabetCmd)
+	alphabetCmd.AddCommand(alphabetCheckCmd)
+}
+
+// describeChar returns the code point, name, and
+// utf-8 and utf-16 lengths of r
+func describeChar(r rune) string {
+	return fmt.Sprintf("U+%04X %v (utf-8: %v, utf-16: %v)",
+		r, runenames.Name(r), utf8.RuneLen(r), utf16Len(r))
+}
+
+// utf16Len returns the number of utf-16 code units needed to encode r
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2 // surrogate pair
+	}
+	return 1
+}
+
+// alphabetCost returns the length of the longest character in table
+// in bytes of utf-8 and in utf-16 code units
+func alphabetCost(table []string) (maxUTF8, maxUTF16 int) {
+	for _, v := range table {
+		r, size := utf8.DecodeRuneInString(v)
+		if size > maxUTF8 {
+			maxUTF8 = size
+		}
+		if l := utf16Len(r); l > maxUTF16 {
+			maxUTF16 = l
+		}
+	}
+	return maxUTF8, maxUTF16
+}
+
+// alphabetErrors returns the errors which prevent a from being used
+// for the delim and for each index of the table
+func alphabetErrors(a *alphabet) (delimErrs []string, errs map[int][]string) {
+	errs = make(map[int][]string)
+	if err := zwc.ValidAlphabet(a.table, a.delim); err != nil {
+		for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+			e := err.(zwc.InvalidAlphabetError)
+			if e.InvalidDelim {
+				delimErrs = append(delimErrs, err.Error())
+			} else {
+				errs[e.Index] = append(errs[e.Index], err.Error())
+			}
+		}
+	}
+	return delimErrs, errs
+}
+
+// lintChar returns warnings about properties of r which may cause it
+// to be displayed or to change how the message is displayed
+func lintChar(r rune) []string {
+	var warnings []string
+
+	if !defaultIgnorable(r) {
+		warnings = append(warnings, "not a Default_Ignorable_Code_Point, "+
+			"may be displayed if it isn't supported")
+	}
+
+	if !zeroWidth(r) {
+		warnings = append(warnings, "not zero width")
+	}
+
+	if warning := bidiWarning(r); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if unicode.Is(unicode.Deprecated, r) {
+		warnings = append(warnings, "deprecated format character, "+
+			"may change how the message is displayed")
+	}
+
+	if ccc := norm.NFC.PropertiesString(string(r)).CCC(); ccc != 0 {
+		warnings = append(warnings, fmt.Sprintf("combining class %v, "+
+			"may be reordered by normalization", ccc))
+	} else if unicode.Is(unicode.M, r) {
+		warnings = append(warnings, "combining mark, "+
+			"attaches to the preceding character")
+	}
+
+	return warnings
+}
+
+// bidiWarning returns a warning if r may change
+// the direction of the message and "" otherwise
+func bidiWarning(r rune) string {
+	props, _ := bidi.LookupRune(r)
+	switch class := props.Class(); class {
+	case bidi.LRO, bidi.RLO, bidi.LRE, bidi.RLE, bidi.PDF,
+		bidi.LRI, bidi.RLI, bidi.FSI, bidi.PDI:
+		return "bidi control (class " + bidiClassNames[class] +
+			"), may change the direction of the message"
+	case bidi.L, bidi.R, bidi.AL:
+		return "strong bidi class " + bidiClassNames[class] +
+			", may change the direction of the message"
+	}
+	return ""
+}
+
+// defaultIgnorable reports whether r has
+// the derived property Default_Ignorable_Code_Point
+func defaultIgnorable(r rune) bool {
+	switch {
+	case unicode.Is(unicode.Other_Default_Ignorable_Code_Point, r),
+		unicode.Is(unicode.Variation_Selector, r):
+		return true
+	case unicode.Is(unicode.White_Space, r),
+		unicode.Is(unicode.Prepended_Concatenation_Mark, r),
+		0xFFF9 <= r && r <= 0xFFFB,   // interlinear annotation characters
+		0x13430 <= r && r <= 0x1343F: // egyptian hieroglyph format controls
+		return false
+	}
+	return unicode.Is(unicode.Cf, r)
+}
+
+// zeroWidth reports whether r is normally displayed without width
+func zeroWidth(r rune) bool {
+	return defaultIgnorable(r) || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf)
+}
+
+var bidiClassNames = map[bidi.Class]string{
+	bidi.L: "L", bidi.R: "R", bidi.AL: "AL",
+	bidi.LRO: "LRO", bidi.RLO: "RLO", bidi.LRE: "LRE", bidi.RLE: "RLE",
+	bidi.PDF: "PDF", bidi.LRI: "LRI", bidi.RLI: "RLI", bidi.FSI: "FSI",
+	bidi.PDI: "PDI",
+}
+
+// alphabetFile is the JSON format of an alphabet file.
+// Characters are written as code points (e.g. "U+200C")
+// or as the character itself.
+type alphabetFile struct {
+	Delim string   `json:"delim"`
+	Table []string `json:"table"`
+}
+
+// alphabet is a table of characters and a delim char
+// which can be passed to zwc.NewCustomTableEncoding
+type alphabet struct {
+	table []string
+	delim rune
+	size  int // number of characters in table
+}
+
+// loadAlphabet reads and parses the alphabet file named filename
+func loadAlphabet(filename string) (*alphabet, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var file alphabetFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, fmt.Errorf("%v: %w", filename, err)
+	}
+
+	return parseAlphabet(file)
+}
+
+func parseAlphabet(file alphabetFile) (*alphabet, error) {
+	var a alphabet
+
+	if len(file.Table) < 4 || len(file.Table) > 256 {
+		return nil, fmt.Errorf("alphabet must have 4 to 256 characters, not %v",
+			len(file.Table))
+	}
+	a.size = len(file.Table)
+	a.table = make([]string, a.size)
+
+	if file.Delim == "" {
+		return nil, errors.New("alphabet is missing delim")
+	}
+	delim, err := parseCodePoint(file.Delim)
+	if err != nil {
+		return nil, fmt.Errorf("delim: %w", err)
+	}
+	a.delim = delim
+
+	for i, v := range file.Table {
+		r, err := parseCodePoint(v)
+		if err != nil {
+			return nil, fmt.Errorf("table index %v: %w", i, err)
+		}
+		a.table[i] = string(r)
+	}
+
+	return &a, nil
+}
+
+// parseCodePoint parses either a code point in the form U+XXXX
+// or a string containing a single character
+func parseCodePoint(s string) (rune, error) {
+	if strings.HasPrefix(s, "U+") || strings.HasPrefix(s, "u+") {
+		n, err := strconv.ParseUint(s[2:], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			return 0, fmt.Errorf("invalid code point %q", s)
+		}
+		return rune(n), nil
+	}
+
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, fmt.Errorf("%q is not a single character", s)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return 0, fmt.Errorf("%q is not valid utf-8", s)
+	}
+	return r, nil
+}
+
+// maxEncodingType returns the largest encoding type
+// which the alphabet has enough characters for.
+// Base-N encoding can be used with any alphabet.
+func (a *alphabet) maxEncodingType() int {
+	switch {
+	case a.size >= 256:
+		return 8
+	case a.size >= 64:
+		return 6
+	case a.size >= 32:
+		return 5
+	case a.size >= 16:
+		return 4
+	case a.size >= 8:
+		return 3
+	}
+	return 2
+}
+
+// getAlphabet loads the alphabet from the alphabet flag.
+// It returns nil if the flag isn't set.
+func getAlphabet(cmd *cobra.Command) *alphabet {
+	filename, err := cmd.Flags().GetString("alphabet")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc: error reading alphabet flag")
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+
+	if filename == "" {
+		return nil
+	}
+
+	a, err := loadAlphabet(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(1)
+	}
+
+	if err := zwc.ValidAlphabet(a.table, a.delim); err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		fmt.Fprintln(os.Stderr, "zwc: run 'zwc alphabet check", filename+"' for details")
+		os.Exit(1)
+	}
+	return a
+}
+
+// getProfile returns the name of the profile from the profile flag.
+// It returns the empty string if the flag isn't set.
+func getProfile(cmd *cobra.Command) string {
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc: error reading profile flag")
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+
+	if profile != "" && cmd.Flags().Changed("alphabet") {
+		fmt.Fprintln(os.Stderr, "zwc: alphabet and profile flags are mutually exclusive")
+		os.Exit(1)
+	}
+	return profile
+}
+
+// newEncoding creates an Encoding which uses a if it isn't nil
+// or the profile called profile if it isn't empty.
+// It exits if the settings are invalid.
+func newEncoding(a *alphabet, profile string, version, encodingType, checksumType int) *zwc.Encoding {
+	var enc *zwc.Encoding
+	var err error
+	switch {
+	case a != nil:
+		enc, err = zwc.NewCustomTableEncodingE(a.table, a.delim, version, encodingType, checksumType)
+	case profile != "":
+		enc, err = zwc.NewProfileEncodingE(profile, encodingType, checksumType)
+	default:
+		enc, err = zwc.NewEncodingE(version, encodingType, checksumType)
+	}
+	if err == nil {
+		return enc
+	}
+
+	switch {
+	case errors.Is(err, zwc.ErrInvalidProfile):
+		fmt.Fprintln(os.Stderr, "zwc: unknown profile", profile)
+		fmt.Fprintln(os.Stderr, "zwc: profiles are", strings.Join(zwc.ProfileNames(), ", "))
+	case errors.Is(err, zwc.ErrUnsupportedTable) && a != nil:
+		fmt.Fprintf(os.Stderr, "zwc: alphabet has %v characters which is too few for encoding %v\n",
+			a.size, encodingType)
+	case errors.Is(err, zwc.ErrUnsupportedTable):
+		fmt.Fprintf(os.Stderr, "zwc: profile %v has too few characters for encoding %v\n",
+			profile, encodingType)
+	default:
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+	}
+	os.Exit(1)
+	return nil
+}
+
+// decodeEncodingFromReader decodes the header in r within the scan limit
+// using a if it isn't nil.
+// Otherwise the header may use any of the built-in profiles.
+func decodeEncodingFromReader(a *alphabet, r io.Reader, limits zwc.DecoderOptions) (*zwc.Encoding, error) {
+	if a == nil {
+		return limits.DecodeEncodingFromReader(r)
+	}
+
+	v, e, c, err := limits.DecodeCustomHeaderFromReader(a.table, a.delim, r)
+	if err != nil {
+		return nil, err
+	}
+	return newEncoding(a, "", v, e, c), nil
+}
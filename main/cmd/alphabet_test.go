@@ -0,0 +1,89 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintChar(t *testing.T) {
+	testCases := []struct {
+		r        rune
+		expected []string // prefixes of the warnings in order
+	}{
+		{'\u200B', nil},
+		{'\u034F', []string{"combining mark"}},
+		{'\u202E', []string{"bidi control (class RLO)"}},
+		{'\u2066', []string{"bidi control (class LRI)"}},
+		{'\u200F', []string{"strong bidi class R"}},
+		{'a', []string{"not a Default_Ignorable_Code_Point",
+			"not zero width", "strong bidi class L"}},
+		{'\u2062', nil},
+		{'\u0301', []string{"not a Default_Ignorable_Code_Point",
+			"combining class 230"}},
+	}
+
+	for i, tc := range testCases {
+		warnings := lintChar(tc.r)
+		if len(warnings) != len(tc.expected) {
+			t.Errorf("testcase %v: Expected %q, got %q", i, tc.expected, warnings)
+			continue
+		}
+		for j, w := range warnings {
+			if !strings.HasPrefix(w, tc.expected[j]) {
+				t.Errorf("testcase %v: Expected %q, got %q", i, tc.expected[j], w)
+			}
+		}
+	}
+}
+
+func TestAlphabetErrors(t *testing.T) {
+	testCases := []struct {
+		file      alphabetFile
+		delimErrs int
+		errs      map[int]string // index to prefix of its error
+	}{
+		{alphabetFile{"U+034F", []string{"U+200B", "U+200C", "U+200D", "U+2060"}},
+			0, map[int]string{}},
+		{alphabetFile{"U+034F", []string{"U+200B", "U+200C", "U+200B", "U+2060"}},
+			0, map[int]string{2: "invalid alphabet: duplicate character"}},
+		{alphabetFile{"U+200C", []string{"U+200B", "U+200C", "U+200D", "U+2060"}},
+			0, map[int]string{1: "invalid alphabet: character in table at index 1"}},
+	}
+
+	for i, tc := range testCases {
+		a, err := parseAlphabet(tc.file)
+		if err != nil {
+			t.Error("testcase", i, ": parseAlphabet returned an error of", err)
+			continue
+		}
+
+		delimErrs, errs := alphabetErrors(a)
+		if len(delimErrs) != tc.delimErrs {
+			t.Errorf("testcase %v: Expected %v delim errors, got %q", i, tc.delimErrs, delimErrs)
+		}
+		if len(errs) != len(tc.errs) {
+			t.Errorf("testcase %v: Expected %v, got %q", i, tc.errs, errs)
+		}
+		for index, prefix := range tc.errs {
+			if len(errs[index]) != 1 || !strings.HasPrefix(errs[index][0], prefix) {
+				t.Errorf("testcase %v: Expected %q at index %v, got %q", i, prefix, index, errs[index])
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yadayadajaychan/zwc"
+)
+
+// zeroWidthCarrier is the default carrier, which inserts the file
+// into the message with the streaming Encoder and Decoder.
+// It isn't registered in the zwc package since a zwc.Carrier
+// needs the whole message and data at once.
+const zeroWidthCarrier = "zero-width"
+
+// getCarrier reads the carrier flag.
+// It returns the empty string if the flag isn't set.
+// Carriers other than zero-width are looked up in the registry of the zwc package,
+// so carriers registered by other packages can be used too.
+func getCarrier(cmd *cobra.Command) string {
+	carrier, err := cmd.Flags().GetString("carrier")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc: error reading carrier flag")
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+
+	if carrier == "" || carrier == zeroWidthCarrier || zwc.LookupCarrier(carrier) != nil {
+		return carrier
+	}
+
+	names := append([]string{zeroWidthCarrier}, zwc.CarrierNames()...)
+	fmt.Fprintln(os.Stderr, "zwc: unknown carrier", carrier)
+	fmt.Fprintln(os.Stderr, "zwc: carriers are", strings.Join(names, ", "))
+	os.Exit(1)
+	return ""
+}
+
+// encodeCarrier hides data in message with carrier
+// and writes the result to stdout
+func encodeCarrier(carrier string, encoding *zwc.Encoding, message, data io.Reader, verbose int) {
+	m, err := io.ReadAll(message)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+	d, err := io.ReadAll(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+
+	c := zwc.LookupCarrier(carrier)
+	if capacity := c.Capacity(encoding, m); verbose >= 1 && capacity >= 0 {
+		fmt.Fprintf(os.Stderr, "zwc: message can hold %v bytes of data\n", capacity)
+	}
+
+	text, err := c.Encode(encoding, m, d)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		if errors.Is(err, zwc.ErrCarrier) {
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+
+	if _, err := os.Stdout.Write(text); err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+
+	if verbose >= 2 {
+		fmt.Fprintf(os.Stderr, "zwc: carrier %v, version %v, encoding %v, checksum %v, profile %v\n",
+			carrier, encoding.Version(), encoding.EncodingType(),
+			encoding.ChecksumType(), encoding.Profile())
+		fmt.Fprintf(os.Stderr, "zwc: %v bytes of data encoded\n", len(d))
+	}
+}
+
+// detectCarrier tries to decode text with each registered carrier.
+// It returns false if none of them find data in text.
+func detectCarrier(text []byte, limits zwc.DecoderOptions, message bool, verbose int) bool {
+	for _, carrier := range zwc.CarrierNames() {
+		if decodeCarrier(carrier, bytes.NewReader(text), limits, message, verbose) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeCarrier decodes the data hidden in text with carrier within limits
+// and writes it to stdout, or the message if message is true
+func decodeCarrier(carrier string, text io.Reader, limits zwc.DecoderOptions, message bool, verbose int) error {
+	data, m, err := limits.DecodeCarrier(zwc.LookupCarrier(carrier), text)
+	if err != nil {
+		return err
+	}
+
+	if verbose >= 2 {
+		fmt.Fprintf(os.Stderr, "zwc: carrier %v\n", carrier)
+		fmt.Fprintf(os.Stderr, "zwc: %v bytes of data decoded\n", len(data))
+	}
+
+	if message {
+		data = m
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
@@ -17,6 +17,9 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -63,56 +66,225 @@ var decodeCmd = &cobra.Command{
 			os.Exit(2)
 		}
 
+		auto, err := cmd.Flags().GetBool("auto")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading auto flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
+		raw, err := cmd.Flags().GetBool("raw")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading raw flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
+		encodingType, err := cmd.Flags().GetInt("encoding")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading encoding flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
+		message, err := cmd.Flags().GetBool("message")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading message flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
+		if raw && (auto || force != "") {
+			fmt.Fprintln(os.Stderr, "zwc: raw flag can't be used with auto or force flags")
+			os.Exit(1)
+		} else if !raw && cmd.Flags().Changed("encoding") {
+			fmt.Fprintln(os.Stderr, "zwc: encoding flag requires raw flag")
+			os.Exit(1)
+		}
+
+		if auto && force != "" {
+			fmt.Fprintln(os.Stderr, "zwc: auto and force flags are mutually exclusive")
+			os.Exit(1)
+		}
+
+		rangeFlag, err := cmd.Flags().GetString("range")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading range flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
+		var off, length int
+		if rangeFlag != "" {
+			if raw {
+				fmt.Fprintln(os.Stderr, "zwc: range flag can't be used with raw flag")
+				os.Exit(1)
+			}
+			off, length = parseRange(rangeFlag)
+		}
+
 		if textFilename == "" || textFilename == "-" {
 			textFilename = "/dev/stdin"
 		}
 
 		var text io.Reader
+		var file *os.File // nil if text is buffered
 		if textFilename == "/dev/stdin" {
 			if term.IsTerminal(int(os.Stdin.Fd())) {
 				text = bufferStdin()
 			} else {
-				text = os.Stdin
+				file = os.Stdin
+				text = file
 			}
 		} else {
-			text, err = os.Open(textFilename)
+			file, err = os.Open(textFilename)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, "zwc: ", err)
 				os.Exit(1)
 			}
+			text = file
+		}
+		// the header and the payload are read through the same buffer
+		br := bufio.NewReader(text)
+		text = br
+
+		a := getAlphabet(cmd)
+		profile := getProfile(cmd)
+		if profile != "" && !raw && force == "" {
+			fmt.Fprintln(os.Stderr, "zwc: profile flag requires raw or force flag")
+			os.Exit(1)
+		}
+
+		jobs := getJobs(cmd)
+		limits := getLimits(cmd)
+
+		if limits.MaxFiles != 1 && (raw || auto || force != "" || a != nil || rangeFlag != "") {
+			fmt.Fprintln(os.Stderr, "zwc: max-files flag can't be used with raw, auto, force, alphabet, or range flags")
+			os.Exit(1)
+		}
+
+		carrier := getCarrier(cmd)
+		if carrier != "" && carrier != zeroWidthCarrier {
+			if raw || auto || force != "" || a != nil || profile != "" || rangeFlag != "" {
+				fmt.Fprintln(os.Stderr, "zwc: carrier", carrier, "can't be used with raw, auto, force, alphabet, profile, or range flags")
+				os.Exit(1)
+			}
+
+			if err := decodeCarrier(carrier, text, limits, message, verbose); err != nil {
+				fmt.Fprintln(os.Stderr, "zwc:", err)
+				os.Exit(2)
+			}
+			return
+		}
+
+		// if there is no header, the other carriers are tried
+		// so the text read while looking for it is kept
+		var seen bytes.Buffer
+		headerText := text
+		if carrier == "" {
+			headerText = io.TeeReader(text, &seen)
+		}
+
+		// the header isn't looked for after the scan limit,
+		// even if it is forced
+		checkScan := func(err error) {
+			if errors.Is(err, zwc.ErrLimit) {
+				fmt.Fprintln(os.Stderr, "zwc:", err)
+				os.Exit(2)
+			}
 		}
 
-		var decoder io.Reader
+		var decoder io.Reader // only used by raw
 		var encoding *zwc.Encoding
-		var v, e, c int
+		var cat bool
 
-		if force == "" {
-			v, e, c, err = zwc.DecodeHeaderFromReader(text)
-			if err != nil {
+		if raw {
+			encoding = newEncoding(a, profile, minVersion(encodingType), encodingType, 0)
+			decoder = limits.LimitPayload(zwc.NewRawDecoder(encoding, text))
+		} else if auto {
+			encoding, err = decodeEncodingFromReader(a, headerText, limits)
+			checkScan(err)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				if carrier == "" && detectCarrier(seen.Bytes(), limits, message, verbose) {
+					return
+				}
 				fmt.Fprintln(os.Stderr, "zwc: ", err)
 				os.Exit(2)
-			}
+			} else if err != nil {
+				if !quiet {
+					fmt.Fprintln(os.Stderr, "zwc: warning: ", err)
+				}
 
-			encoding = zwc.NewEncoding(v, e, c)
-			decoder = zwc.NewCustomDecoder(encoding, text)
+				text, encoding = detectEncoding(a, text, limits, verbose)
+			}
+		} else if force == "" && limits.MaxFiles != 1 {
+			// every file decodes its own header
+			cat = true
+		} else if force == "" {
+			encoding, err = decodeEncodingFromReader(a, headerText, limits)
+			checkScan(err)
+			if (err == io.EOF || err == io.ErrUnexpectedEOF) && carrier == "" &&
+			   detectCarrier(seen.Bytes(), limits, message, verbose) {
+				return
+			} else if err != nil {
+				fmt.Fprintln(os.Stderr, "zwc: ", err)
+				os.Exit(2)
+			}
 		} else {
-			v, e, c = parseForce(force)
+			v, e, c := parseForce(force)
 
 			// ignore values from header
-			_, _, _, err = zwc.DecodeHeaderFromReader(text)
+			_, err = decodeEncodingFromReader(a, headerText, limits)
+			checkScan(err)
 			if err != nil && !quiet {
 				fmt.Fprintln(os.Stderr, "zwc: warning: ", err)
 			}
 
-			encoding = zwc.NewEncoding(v, e, c)
-			decoder = zwc.NewCustomDecoder(encoding, text)
+			encoding = newEncoding(a, profile, v, e, c)
+		}
+
+		if rangeFlag != "" {
+			decodeRange(encoding, text, off, length, limits, quiet)
+			return
 		}
 
-		n, err := io.Copy(os.Stdout, decoder)
-		if verbose >= 2 {
-			fmt.Fprintf(os.Stderr, "zwc: version %v, encoding %v, checksum %v\n", v, e, c)
+		ctx, stop := streamContext()
+		defer stop()
+
+		var n int64
+		var crc uint64
+		if raw {
+			n, err = io.Copy(os.Stdout, decoder)
+		} else {
+			// the total is only known if the text is still read from the file
+			var total int64
+			if text == br {
+				total = remaining(file, br)
+			}
+
+			bar := newProgressBar()
+			n, crc, err = zwc.DecodeStream(ctx, encoding, os.Stdout, text, zwc.StreamOptions{
+				Progress: bar.update,
+				Total:    total,
+				Jobs:     jobs,
+				Limits:   limits,
+				Cat:      cat,
+			})
+			bar.clear()
+			exitInterrupted(err)
+		}
+		if verbose >= 2 && raw {
+			fmt.Fprintf(os.Stderr, "zwc: raw, encoding %v, profile %v\n",
+						encoding.EncodingType(), encoding.Profile())
 			fmt.Fprintf(os.Stderr, "zwc: %v bytes of data decoded\n", n)
-			fmt.Fprintf(os.Stderr, "zwc: crc is %x\n", encoding.Checksum())
+		} else if verbose >= 2 && encoding == nil { // concatenated files
+			fmt.Fprintf(os.Stderr, "zwc: %v bytes of data decoded\n", n)
+		} else if verbose >= 2 {
+			fmt.Fprintf(os.Stderr, "zwc: version %v, encoding %v, checksum %v, profile %v\n",
+						encoding.Version(), encoding.EncodingType(),
+						encoding.ChecksumType(), encoding.Profile())
+			fmt.Fprintf(os.Stderr, "zwc: %v bytes of data decoded\n", n)
+			fmt.Fprintf(os.Stderr, "zwc: crc is %x\n", crc)
 		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "zwc:", err)
@@ -130,6 +302,162 @@ func init() {
 	decodeCmd.Flags().BoolP("message", "m", false, "Output message")
 
 	decodeCmd.Flags().StringP("force", "f", "", "Force encoding")
+	decodeCmd.Flags().BoolP("auto", "a", false, "Detect encoding if header is corrupt")
+	decodeCmd.Flags().BoolP("raw", "r", false, "Decode a payload without signature, header, or checksum")
+	decodeCmd.Flags().IntP("encoding", "e", 3, "Encoding type of raw payload")
+	decodeCmd.Flags().StringP("alphabet", "A", "", "Alphabet file")
+	decodeCmd.Flags().StringP("profile", "p", "", "Built-in alphabet profile of raw or forced payload")
+	decodeCmd.Flags().StringP("carrier", "C", "", "How the data is hidden in the message (default: detect)")
+	decodeCmd.Flags().IntP("jobs", "j", 1, "Number of goroutines decoding large text (0: one per CPU)")
+	decodeCmd.Flags().String("range", "", "Only decode LEN bytes of data starting at byte OFF (OFF:LEN)")
+	decodeCmd.Flags().Int64("max-payload-bytes", 1<<30, "Maximum bytes of data to decode (0: no limit)")
+	decodeCmd.Flags().Int64("max-scan-bytes", 64<<20, "Maximum bytes of text to read while looking for the header (0: no limit)")
+	decodeCmd.Flags().Int("max-files", 1, "Maximum number of concatenated files to decode (0: no limit)")
+}
+
+// detectEncoding reads the rest of text within the scan limit
+// and picks the most likely encoding for it.
+// r holds the bytes which were read from text.
+func detectEncoding(a *alphabet, text io.Reader, limits zwc.DecoderOptions, verbose int) (r io.Reader, encoding *zwc.Encoding) {
+	rest, err := limits.ReadText(text)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+
+	var candidates []zwc.Candidate
+	if a == nil {
+		candidates = zwc.DetectEncoding(rest)
+	} else {
+		candidates = zwc.DetectCustomEncoding(a.table, a.delim, rest)
+	}
+	if len(candidates) == 0 {
+		fmt.Fprintln(os.Stderr, "zwc: unable to detect encoding")
+		os.Exit(2)
+	}
+
+	if verbose >= 2 {
+		for _, cand := range candidates {
+			fmt.Fprintf(os.Stderr, "zwc: candidate encoding %v, checksum %v, profile %v (crc match: %v, guessed: %v)\n",
+						cand.EncodingType, cand.ChecksumType, candidateProfile(cand),
+						cand.CRCMatch, cand.Guessed)
+		}
+	}
+
+	best := candidates[0]
+	if verbose >= 1 {
+		if best.CRCMatch {
+			fmt.Fprintf(os.Stderr, "zwc: detected encoding %v, checksum %v, profile %v (crc matches)\n",
+						best.EncodingType, best.ChecksumType, candidateProfile(best))
+		} else {
+			fmt.Fprintf(os.Stderr, "zwc: guessed encoding %v, checksum %v, profile %v (unverified)\n",
+						best.EncodingType, best.ChecksumType, candidateProfile(best))
+		}
+	}
+
+	encoding = newEncoding(a, best.Profile, best.Version, best.EncodingType, best.ChecksumType)
+	return bytes.NewReader(rest), encoding
+}
+
+// candidateProfile returns the name of the profile of c
+func candidateProfile(c zwc.Candidate) string {
+	if c.Profile == "" {
+		return "custom"
+	}
+	return c.Profile
+}
+
+// getLimits returns the limits set by the max-* flags.
+// It exits if any of them are negative.
+func getLimits(cmd *cobra.Command) zwc.DecoderOptions {
+	var limits zwc.DecoderOptions
+	var err error
+
+	for _, f := range []struct {
+		name  string
+		value *int64
+	}{
+		{"max-payload-bytes", &limits.MaxPayloadBytes},
+		{"max-scan-bytes", &limits.MaxScanBytes},
+	} {
+		*f.value, err = cmd.Flags().GetInt64(f.name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading", f.name, "flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+		if *f.value < 0 {
+			fmt.Fprintln(os.Stderr, "zwc:", f.name, "must not be negative")
+			os.Exit(1)
+		}
+	}
+
+	limits.MaxFiles, err = cmd.Flags().GetInt("max-files")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc: error reading max-files flag")
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+	if limits.MaxFiles < 0 {
+		fmt.Fprintln(os.Stderr, "zwc: max-files must not be negative")
+		os.Exit(1)
+	}
+
+	return limits
+}
+
+// decodeRange decodes length bytes of the data in text starting at byte off
+// and writes them to stdout.
+// text is the rest of the file after the header,
+// which is only read up to the end of the range.
+// Like the other data, the range can't be longer than the payload limit.
+func decodeRange(encoding *zwc.Encoding, text io.Reader, off, length int, limits zwc.DecoderOptions, quiet bool) {
+	// one byte more than the limit is decoded
+	// to find out if the range is longer
+	limit := limits.MaxPayloadBytes
+	if limit > 0 && int64(length) > limit {
+		length = int(limit) + 1
+	}
+
+	data, err := encoding.DecodeRangeFromReader(text, off, length)
+	if limit > 0 && int64(len(data)) > limit {
+		data, err = data[:limit], zwc.LimitError{PayloadBytes: true, Limit: limit}
+	}
+	if _, err := os.Stdout.Write(data); err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+
+	if err == io.EOF {
+		if !quiet {
+			fmt.Fprintln(os.Stderr, "zwc: warning: range goes past the end of the data")
+		}
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+}
+
+// parseRange parses the range flag, which is OFF:LEN
+func parseRange(r string) (off, length int) {
+	o, l, ok := strings.Cut(r, ":")
+	if !ok {
+		fmt.Fprintln(os.Stderr, "zwc: range flag requires an offset and a length separated by a colon")
+		os.Exit(1)
+	}
+
+	off, err := strconv.Atoi(o)
+	if err != nil || off < 0 {
+		fmt.Fprintln(os.Stderr, "zwc: range offset must be a non-negative integer")
+		os.Exit(1)
+	}
+
+	length, err = strconv.Atoi(l)
+	if err != nil || length < 0 {
+		fmt.Fprintln(os.Stderr, "zwc: range length must be a non-negative integer")
+		os.Exit(1)
+	}
+	return off, length
 }
 
 // parse force flag
@@ -158,26 +486,36 @@ func parseForce(force string) (v, e, c int) {
 		os.Exit(1)
 	}
 
-	switch fconv[0] {
-	case 2, 3, 4:
-		e = fconv[0]
-	case 0, 8, 16, 32:
-		c = fconv[0]
-	default:
+	e, c, err = forceTypes(fconv[0], fconv[1])
+	if err != nil {
 		fmt.Fprintln(os.Stderr, "zwc: force argument contains invalid encoding/checksum type")
+		fmt.Fprintln(os.Stderr, "zwc:", err)
 		os.Exit(1)
 	}
 
-	switch fconv[1] {
-	case 2, 3, 4:
-		e = fconv[1]
-	case 0, 8, 16, 32:
-		c = fconv[1]
-	default:
-		fmt.Fprintln(os.Stderr, "zwc: force argument contains invalid encoding/checksum type")
-		os.Exit(1)
+	return minVersion(e), e, c
+}
+
+// forceTypes returns the encoding and checksum types
+// of the values a and b of the force flag in either order.
+// 0 and 8 are both encoding and checksum types,
+// so b is tried as the encoding first.
+// The values are checked by the same constructor used by encode.
+// If neither order is valid, the error is from the order
+// whose encoding type is valid if there is one.
+func forceTypes(a, b int) (e, c int, err error) {
+	_, err = zwc.NewEncodingE(minVersion(b), b, a)
+	if err == nil {
+		return b, a, nil
 	}
 
-	v = 1
-	return v, e, c
+	_, swapErr := zwc.NewEncodingE(minVersion(a), a, b)
+	if swapErr == nil {
+		return a, b, nil
+	}
+
+	if errors.Is(err, zwc.ErrInvalidEncodingType) && !errors.Is(swapErr, zwc.ErrInvalidEncodingType) {
+		err = swapErr
+	}
+	return 0, 0, err
 }
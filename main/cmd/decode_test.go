@@ -0,0 +1,50 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yadayadajaychan/zwc"
+)
+
+func TestForceTypes(t *testing.T) {
+	testCases := []struct {
+		a, b     int
+		e, c     int
+		expected error
+	}{
+		{16, 3, 3, 16, nil},
+		{3, 16, 3, 16, nil},
+		{8, 0, 0, 8, nil},
+		{32, 8, 8, 32, nil},
+		{3, 24, 0, 0, zwc.ErrInvalidChecksumType},
+		{24, 3, 0, 0, zwc.ErrInvalidChecksumType},
+		{7, 24, 0, 0, zwc.ErrInvalidEncodingType},
+	}
+
+	for i, tc := range testCases {
+		e, c, err := forceTypes(tc.a, tc.b)
+		if e != tc.e || c != tc.c {
+			t.Errorf("testcase %v: Expected %v, %v, got %v, %v", i, tc.e, tc.c, e, c)
+		}
+		if !errors.Is(err, tc.expected) {
+			t.Errorf("testcase %v: Expected error %v, got %v", i, tc.expected, err)
+		}
+	}
+}
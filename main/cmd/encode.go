@@ -64,6 +64,13 @@ var encodeCmd = &cobra.Command{
 			os.Exit(2)
 		}
 
+		raw, err := cmd.Flags().GetBool("raw")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading raw flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
 		verbose, err := cmd.Flags().GetCount("verbose")
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "zwc: error reading verbose flag")
@@ -103,8 +110,21 @@ var encodeCmd = &cobra.Command{
 			messageFilename = "/dev/stdin"
 		}
 
+		carrier := getCarrier(cmd)
+		if carrier != "" && carrier != zeroWidthCarrier {
+			if raw || noMessage {
+				fmt.Fprintln(os.Stderr, "zwc: carrier", carrier, "requires a message")
+				os.Exit(1)
+			}
+			if getAlphabet(cmd) != nil {
+				fmt.Fprintln(os.Stderr, "zwc: carrier", carrier, "can't be used with an alphabet")
+				os.Exit(1)
+			}
+		}
+
 		encoding := createEncoding(cmd)
-		encoder := zwc.NewEncoder(encoding, os.Stdout)
+
+		jobs := getJobs(cmd)
 
 		var data, message io.Reader
 
@@ -127,7 +147,7 @@ var encodeCmd = &cobra.Command{
 			}
 
 			if err := scanner.Err(); err != nil {
-				fmt.Fprintf(os.Stderr, "zwc:", err)
+				fmt.Fprintln(os.Stderr, "zwc:", err)
 				os.Exit(2)
 			}
 
@@ -207,6 +227,10 @@ var encodeCmd = &cobra.Command{
 			}
 		}
 
+		if carrier != "" && carrier != zeroWidthCarrier {
+			encodeCarrier(carrier, encoding, message, data, verbose)
+			return
+		}
 
 		var fmi int
 		if !noMessage {
@@ -236,13 +260,23 @@ var encodeCmd = &cobra.Command{
 		}
 
 		// encode data
-		nDataEncoded, err := io.Copy(encoder, data)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "zwc:", err)
-			os.Exit(2)
+		var nDataEncoded int64
+		var crc uint64
+		if raw {
+			encoder := zwc.NewRawEncoder(encoding, os.Stdout)
+			nDataEncoded, err = io.Copy(encoder, data)
+			if err == nil {
+				err = encoder.Close()
+			}
+		} else {
+			ctx, stop := streamContext()
+			bar := newProgressBar()
+			nDataEncoded, crc, err = zwc.EncodeStream(ctx, encoding, os.Stdout, data, nil,
+			                                         zwc.StreamOptions{Progress: bar.update, Jobs: jobs})
+			bar.clear()
+			stop()
+			exitInterrupted(err)
 		}
-
-		err = encoder.Close()
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "zwc:", err)
 			os.Exit(2)
@@ -260,11 +294,15 @@ var encodeCmd = &cobra.Command{
 			}
 		}
 
-		if verbose >= 2 {
-			fmt.Fprintf(os.Stderr, "zwc: version %v, encoding %v, checksum %v\n",
-						encoding.Version(), encoding.EncodingType(), encoding.ChecksumType())
+		if verbose >= 2 && raw {
+			fmt.Fprintf(os.Stderr, "zwc: raw, encoding %v\n", encoding.EncodingType())
+			fmt.Fprintf(os.Stderr, "zwc: %v bytes of data encoded\n", nDataEncoded)
+		} else if verbose >= 2 {
+			fmt.Fprintf(os.Stderr, "zwc: version %v, encoding %v, checksum %v, profile %v\n",
+						encoding.Version(), encoding.EncodingType(),
+						encoding.ChecksumType(), encoding.Profile())
 			fmt.Fprintf(os.Stderr, "zwc: %v bytes of data encoded\n", nDataEncoded)
-			fmt.Fprintf(os.Stderr, "zwc: crc is %x\n", encoding.Checksum())
+			fmt.Fprintf(os.Stderr, "zwc: crc is %x\n", crc)
 		}
 	},
 }
@@ -280,6 +318,11 @@ func init() {
 
 	encodeCmd.Flags().BoolP("interactive", "i", false, "Interactive mode")
 	encodeCmd.Flags().BoolP("no-message", "n", false, "No message")
+	encodeCmd.Flags().BoolP("raw", "r", false, "Only output the encoded payload")
+	encodeCmd.Flags().StringP("alphabet", "A", "", "Alphabet file")
+	encodeCmd.Flags().StringP("profile", "p", "", "Built-in alphabet profile")
+	encodeCmd.Flags().StringP("carrier", "C", zeroWidthCarrier, "How the data is hidden in the message")
+	encodeCmd.Flags().IntP("jobs", "j", 1, "Number of goroutines encoding large data (0: one per CPU)")
 }
 
 func createEncoding(cmd *cobra.Command) *zwc.Encoding {
@@ -297,23 +340,21 @@ func createEncoding(cmd *cobra.Command) *zwc.Encoding {
 		os.Exit(2)
 	}
 
-	switch checksum {
-	case 0, 8, 16, 32:
-	default:
-		fmt.Fprintln(os.Stderr, "zwc: invalid checksum type of", checksum)
-		fmt.Fprintln(os.Stderr, "zwc: checksum must be either 0, 8, 16, or 32")
-		os.Exit(1)
+	// raw payloads don't have a checksum
+	if raw, _ := cmd.Flags().GetBool("raw"); raw {
+		checksum = 0
 	}
 
-	switch encoding {
-	case 2, 3, 4:
-	default:
-		fmt.Fprintln(os.Stderr, "zwc: invalid encoding type of", encoding)
-		fmt.Fprintln(os.Stderr, "zwc: encoding must be either 2, 3, or 4")
-		os.Exit(1)
-	}
+	return newEncoding(getAlphabet(cmd), getProfile(cmd), minVersion(encoding), encoding, checksum)
+}
 
-	return zwc.NewEncoding(1, encoding, checksum)
+// minVersion returns the lowest version of the file format
+// which supports encodingType
+func minVersion(encodingType int) int {
+	if encodingType >= 5 || encodingType == zwc.RadixEncoding {
+		return 2
+	}
+	return 1
 }
 
 func bufferStdin() *bytes.Buffer {
@@ -325,7 +366,7 @@ func bufferStdin() *bytes.Buffer {
 	}
 
 	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "zwc:", err)
+		fmt.Fprintln(os.Stderr, "zwc:", err)
 		os.Exit(2)
 	}
 
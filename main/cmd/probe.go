@@ -0,0 +1,292 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"github.com/yadayadajaychan/zwc"
+	"golang.org/x/term"
+)
+
+const (
+	probeStart = "zwc-probe:"
+	probeEnd   = "|end"
+)
+
+// probeCandidates are the invisible characters tested by the probe,
+// in the order they are preferred when choosing an alphabet
+var probeCandidates = []rune{
+	// characters used by the specification
+	0x202C, 0x200C, 0x200D, 0x2060, 0x2061, 0x2062, 0x2063, 0x2064,
+	0x206A, 0x206B, 0x206C, 0x206D, 0x206E, 0x206F, 0x1D173, 0x1D174,
+	0x034F,
+
+	// doc/unused-chars
+	0x200E, 0x202A,
+	0x1D175, 0x1D176, 0x1D177, 0x1D178, 0x1D179, 0x1D17A,
+
+	// other format characters
+	0x200B, 0x200F, 0x2066, 0x2068, 0x2069,
+	0x180E, 0xFEFF, 0x17B4, 0x17B5,
+	0x1BCA0, 0x1BCA1, 0x1BCA2, 0x1BCA3,
+
+	// variation selectors
+	0xFE00, 0xFE01, 0xFE02, 0xFE03, 0xFE04, 0xFE05, 0xFE06, 0xFE07,
+	0xFE08, 0xFE09, 0xFE0A, 0xFE0B, 0xFE0C, 0xFE0D, 0xFE0E, 0xFE0F,
+
+	// tags
+	0xE0001, 0xE0020, 0xE007F,
+}
+
+// probeCmd represents the probe command
+var probeCmd = &cobra.Command{
+	Use:   "probe",
+	Short: "Find which characters survive a platform",
+	Long: `Find which invisible characters survive being sent through a platform.
+Send the output of 'zwc probe generate' through the platform,
+then give the result to 'zwc probe analyze'.`,
+	Aliases: []string{"p", "pr", "pro", "prob"},
+}
+
+// probeGenerateCmd represents the probe generate command
+var probeGenerateCmd = &cobra.Command{
+	Use:     "generate",
+	Short:   "Output a string containing every candidate character",
+	Aliases: []string{"g", "ge", "gen", "gene", "gener", "genera", "generat"},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(generateProbe())
+	},
+}
+
+// probeAnalyzeCmd represents the probe analyze command
+var probeAnalyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Report which characters survived and output an alphabet file",
+	Long: `Report which characters survived, were stripped, or were replaced
+and output an alphabet file made from the characters which survived.`,
+	Aliases: []string{"a", "an", "ana", "anal", "analy", "analyz"},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		textFilename, err := cmd.Flags().GetString("text")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading text flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
+		quiet, err := cmd.Flags().GetBool("quiet")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading quiet flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+
+		size, err := cmd.Flags().GetInt("size")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc: error reading size flag")
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+		if size != 0 && (size < 4 || size > 256 || size&(size-1) != 0) {
+			fmt.Fprintln(os.Stderr, "zwc: size must be 0 or a power of two from 4 to 256")
+			os.Exit(1)
+		}
+
+		var text []byte
+		if textFilename == "" || textFilename == "-" {
+			if term.IsTerminal(int(os.Stdin.Fd())) {
+				text = bufferStdin().Bytes()
+			} else {
+				text, err = io.ReadAll(os.Stdin)
+			}
+		} else {
+			text, err = os.ReadFile(textFilename)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(1)
+		}
+
+		results, err := analyzeProbe(string(text))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(1)
+		}
+
+		var survived []rune
+		for _, r := range probeCandidates {
+			result := results[r]
+			if result == string(r) {
+				survived = append(survived, r)
+			}
+
+			if quiet {
+				continue
+			}
+			switch {
+			case result == string(r):
+				fmt.Fprintf(os.Stderr, "zwc: U+%04X survived\n", r)
+			case result == "":
+				fmt.Fprintf(os.Stderr, "zwc: U+%04X stripped\n", r)
+			default:
+				fmt.Fprintf(os.Stderr, "zwc: U+%04X replaced with %+q\n", r, result)
+			}
+		}
+
+		file, warned, err := probeAlphabet(survived, size)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(1)
+		}
+		if warned > 0 && !quiet {
+			fmt.Fprintf(os.Stderr, "zwc: warning: %v characters of the alphabet have warnings, "+
+				"see 'zwc alphabet check'\n", warned)
+		}
+
+		output, err := json.MarshalIndent(file, "", "\t")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "zwc:", err)
+			os.Exit(2)
+		}
+		fmt.Println(string(output))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(probeCmd)
+	probeCmd.AddCommand(probeGenerateCmd)
+	probeCmd.AddCommand(probeAnalyzeCmd)
+
+	probeAnalyzeCmd.Flags().StringP("text", "t", "", "Text file")
+	probeAnalyzeCmd.Flags().IntP("size", "s", 16, "Number of characters in the table (0: every usable one, for base-N encoding)")
+}
+
+// generateProbe returns a string containing every candidate
+func generateProbe() string {
+	// each candidate is written as |XXXX:c
+	// where XXXX is the code point and c is the character
+	var b strings.Builder
+	b.WriteString(probeStart)
+	for _, r := range probeCandidates {
+		fmt.Fprintf(&b, "|%04X:%c", r, r)
+	}
+	b.WriteString(probeEnd)
+	return b.String()
+}
+
+// analyzeProbe finds the output of 'zwc probe generate' in text
+// and returns what each candidate was turned into.
+// Candidates which are missing map to the empty string.
+func analyzeProbe(text string) (map[rune]string, error) {
+	start := strings.Index(text, probeStart)
+	if start < 0 {
+		return nil, fmt.Errorf("probe not found, %q is missing", probeStart)
+	}
+	text = text[start+len(probeStart):]
+
+	end := strings.Index(text, probeEnd)
+	if end < 0 {
+		return nil, fmt.Errorf("probe is incomplete, %q is missing", probeEnd)
+	}
+	text = text[:end]
+
+	results := make(map[rune]string, len(probeCandidates))
+	for _, field := range strings.Split(text, "|") {
+		codePoint, result, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(codePoint, 16, 32)
+		if err != nil || !utf8.ValidRune(rune(n)) {
+			continue
+		}
+		results[rune(n)] = result
+	}
+
+	return results, nil
+}
+
+// probeAlphabet chooses a delim char and a table
+// of size characters from the characters which survived,
+// or of every usable character if size is 0.
+// The delim char of the specification is used if it survived.
+// Characters which may change the direction of the message are never used
+// and characters with other warnings from lintChar are only used
+// if there aren't enough characters without warnings.
+// warned is the number of characters with warnings in the table.
+func probeAlphabet(survived []rune, size int) (file alphabetFile, warned int, err error) {
+	var usable []rune
+	for _, r := range survived {
+		if bidiWarning(r) == "" {
+			usable = append(usable, r)
+		}
+	}
+
+	delim := rune(-1)
+	for _, r := range survived {
+		if r == zwc.V1DelimChar {
+			delim = r
+		}
+	}
+	if delim < 0 && len(usable) > 0 {
+		delim = usable[len(usable)-1]
+	}
+
+	// characters without warnings come first
+	var clean, others []rune
+	for _, r := range usable {
+		if r == delim {
+			continue
+		} else if len(lintChar(r)) == 0 {
+			clean = append(clean, r)
+		} else {
+			others = append(others, r)
+		}
+	}
+	chars := append(clean, others...)
+
+	if size == 0 {
+		size = len(chars)
+	}
+	if needed := size; len(chars) < needed || len(chars) < 4 {
+		if needed < 4 {
+			needed = 4
+		}
+		return file, 0, fmt.Errorf("only %v usable characters survived besides the delim, "+
+			"%v are needed (use --size for a smaller table)", len(chars), needed)
+	}
+	chars = chars[:size]
+
+	for i, r := range chars {
+		file.Table = append(file.Table, fmt.Sprintf("U+%04X", r))
+		if i >= len(clean) {
+			warned++
+		}
+	}
+	file.Delim = fmt.Sprintf("U+%04X", delim)
+	return file, warned, nil
+}
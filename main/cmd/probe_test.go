@@ -0,0 +1,102 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yadayadajaychan/zwc"
+)
+
+// TestAnalyzeProbe tests a probe which went through a platform
+// which strips some characters and replaces another
+func TestAnalyzeProbe(t *testing.T) {
+	stripped := []rune{'\u200B', '\uFEFF', '\U000E0001'}
+	replaced := '\u2060'
+
+	probe := generateProbe()
+	for _, r := range stripped {
+		probe = strings.ReplaceAll(probe, string(r), "")
+	}
+	probe = strings.ReplaceAll(probe, string(replaced), " ")
+
+	results, err := analyzeProbe("sent by a friend: " + probe + "\n")
+	if err != nil {
+		t.Fatal("analyzeProbe returned an error of", err)
+	}
+
+	for _, r := range probeCandidates {
+		expected := string(r)
+		if slices.Contains(stripped, r) {
+			expected = ""
+		} else if r == replaced {
+			expected = " "
+		}
+		if results[r] != expected {
+			t.Errorf("U+%04X: Expected %+q, got %+q", r, expected, results[r])
+		}
+	}
+
+	// the probe must be complete
+	if _, err := analyzeProbe("no probe here"); err == nil {
+		t.Error("Expected an error for a missing probe")
+	}
+	if _, err := analyzeProbe(probe[:len(probe)/2]); err == nil {
+		t.Error("Expected an error for an incomplete probe")
+	}
+}
+
+func TestProbeAlphabet(t *testing.T) {
+	file, warned, err := probeAlphabet(probeCandidates, 16)
+	if err != nil {
+		t.Fatal("probeAlphabet returned an error of", err)
+	}
+	if len(file.Table) != 16 || warned != 0 || file.Delim != "U+034F" {
+		t.Errorf("Expected 16 characters without warnings and delim U+034F, got %v, %v, %v",
+			file.Table, warned, file.Delim)
+	}
+
+	// characters which change the direction of the message are never used
+	all, _, err := probeAlphabet(probeCandidates, 0)
+	if err != nil {
+		t.Fatal("probeAlphabet returned an error of", err)
+	}
+	for _, c := range all.Table {
+		if slices.Contains([]string{"U+200F", "U+202A", "U+2066", "U+2068", "U+2069"}, c) {
+			t.Error("Table contains bidi character", c)
+		}
+	}
+
+	// the alphabet can be used for encoding
+	a, err := parseAlphabet(file)
+	if err != nil {
+		t.Fatal("parseAlphabet returned an error of", err)
+	}
+	if err := zwc.ValidAlphabet(a.table, a.delim); err != nil {
+		t.Error("ValidAlphabet returned an error of", err)
+	}
+
+	// without enough characters, a smaller size is needed
+	if _, _, err := probeAlphabet(probeCandidates[:10], 16); err == nil {
+		t.Error("Expected an error for too few characters")
+	}
+	if file, _, err := probeAlphabet(probeCandidates[:10], 8); err != nil || len(file.Table) != 8 {
+		t.Error("Expected 8 characters, got", file.Table, err)
+	}
+}
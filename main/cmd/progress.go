@@ -0,0 +1,132 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// progressMinLen is the smallest input which shows a progress bar
+	progressMinLen = 8 << 20
+
+	// progressInterval is the time between redraws of the progress bar
+	progressInterval = 100 * time.Millisecond
+)
+
+// A progressBar draws the progress of a stream on stderr.
+// It is only drawn if stderr is a terminal and stdout isn't,
+// so it doesn't mix with the output.
+type progressBar struct {
+	enabled bool
+	drawn   bool
+	last    time.Time
+}
+
+func newProgressBar() *progressBar {
+	return &progressBar{
+		enabled: term.IsTerminal(int(os.Stderr.Fd())) && !term.IsTerminal(int(os.Stdout.Fd())),
+	}
+}
+
+// update redraws the bar if total is known and large enough
+// and the bar hasn't been drawn recently
+func (b *progressBar) update(done, total int64) {
+	if !b.enabled || total < progressMinLen {
+		return
+	}
+	if now := time.Now(); now.Sub(b.last) >= progressInterval || done >= total {
+		b.last = now
+	} else {
+		return
+	}
+	if done > total {
+		done = total
+	}
+
+	width, _, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+
+	status := fmt.Sprintf(" %3d%% %.1f/%.1f MiB", done*100/total,
+		float64(done)/(1<<20), float64(total)/(1<<20))
+	barLen := width - len(status) - 3
+	if barLen > 50 {
+		barLen = 50
+	} else if barLen < 10 {
+		barLen = 10
+	}
+
+	filled := int(done * int64(barLen) / total)
+	bar := strings.Repeat("=", filled)
+	if filled < barLen {
+		bar += ">" + strings.Repeat(" ", barLen-filled-1)
+	}
+
+	fmt.Fprintf(os.Stderr, "\r[%s]%s", bar, status)
+	b.drawn = true
+}
+
+// clear erases the bar so it doesn't mix with later messages
+func (b *progressBar) clear() {
+	if b.drawn {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+		b.drawn = false
+	}
+}
+
+// streamContext returns a context which is canceled on an interrupt
+// so the stream stops between reads
+func streamContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// exitInterrupted exits with status 130 if err is from an interrupt
+func exitInterrupted(err error) {
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "zwc: interrupted")
+		os.Exit(130)
+	}
+}
+
+// remaining returns the number of bytes of f which haven't been read
+// through br, or 0 if it isn't known
+func remaining(f *os.File, br *bufio.Reader) int64 {
+	if f == nil {
+		return 0
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0
+	}
+	return info.Size() - off + int64(br.Buffered())
+}
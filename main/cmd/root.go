@@ -17,7 +17,9 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"runtime"
 
 	"github.com/spf13/cobra"
 )
@@ -52,3 +54,29 @@ func init() {
 	rootCmd.PersistentFlags().CountP("verbose", "v", "Verbosity")
 	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Suppress warnings")
 }
+
+// getJobs returns the number of goroutines set by the jobs flag,
+// where 0 means one for each CPU.
+// It exits if the flag is negative or used with the raw flag.
+func getJobs(cmd *cobra.Command) int {
+	jobs, err := cmd.Flags().GetInt("jobs")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "zwc: error reading jobs flag")
+		fmt.Fprintln(os.Stderr, "zwc:", err)
+		os.Exit(2)
+	}
+
+	if jobs < 0 {
+		fmt.Fprintln(os.Stderr, "zwc: jobs must not be negative")
+		os.Exit(1)
+	}
+	if raw, _ := cmd.Flags().GetBool("raw"); raw && cmd.Flags().Changed("jobs") {
+		fmt.Fprintln(os.Stderr, "zwc: jobs flag can't be used with raw flag")
+		os.Exit(1)
+	}
+
+	if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
+	return jobs
+}
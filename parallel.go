@@ -0,0 +1,284 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import (
+	"math/bits"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/snksoft/crc"
+)
+
+// parallelLen is the number of bytes of data for each goroutine
+// which ReadFrom and WriteTo read or write at a time
+const parallelLen = 8 * chunkLen
+
+// A checksum calculates the crc of data which may be split into
+// pieces whose crcs are calculated separately and combined in order
+type checksum struct {
+	table *crc.Table // nil if there is no checksum
+	mask  uint64     // bits of the register used by the crc
+	state uint64     // register of the crc of the data so far
+}
+
+// newChecksum returns a checksum for the checksum type of enc
+func (enc *Encoding) newChecksum() checksum {
+	t := enc.crcTable()
+	if t == nil {
+		return checksum{}
+	}
+	return checksum{t, 1<<enc.checksumType - 1, t.InitCrc()}
+}
+
+// update adds p to the checksum
+func (c *checksum) update(p []byte) {
+	if c.table != nil {
+		c.state = c.table.UpdateCrc(c.state, p)
+	}
+}
+
+// crc returns the checksum of the data so far
+func (c *checksum) crc() uint64 {
+	if c.table == nil {
+		return 0
+	}
+	return c.table.CRC(c.state)
+}
+
+// reset removes all data from the checksum
+func (c *checksum) reset() {
+	if c.table != nil {
+		c.state = c.table.InitCrc()
+	}
+}
+
+// partial returns the register of the crc of p
+// starting from zero instead of the initial value,
+// which is passed to combine
+func (c *checksum) partial(p []byte) uint64 {
+	if c.table == nil {
+		return 0
+	}
+	return c.table.UpdateCrc(0, p) & c.mask
+}
+
+// combine adds n bytes of data whose partial register is state
+// as if the data was passed to update
+func (c *checksum) combine(state uint64, n int) {
+	if c.table != nil {
+		c.state = c.shift(c.state&c.mask, n) ^ state
+	}
+}
+
+// shift returns the register after n zero bytes are processed from state.
+// The crc is linear, so processing a zero byte is multiplying
+// by a matrix over GF(2), which is raised to the power n
+// by squaring instead of processing n bytes.
+func (c *checksum) shift(state uint64, n int) uint64 {
+	width := bits.Len64(c.mask)
+	var zero [1]byte
+
+	// op[i] is the register after a zero byte is processed from 1<<i
+	var op [32]uint64
+	for i := 0; i < width; i++ {
+		op[i] = c.table.UpdateCrc(1<<i, zero[:]) & c.mask
+	}
+
+	for ; n > 0; n >>= 1 {
+		if n&1 != 0 {
+			state = gf2Multiply(op[:width], state)
+		}
+
+		var square [32]uint64
+		for i := 0; i < width; i++ {
+			square[i] = gf2Multiply(op[:width], op[i])
+		}
+		op = square
+	}
+	return state
+}
+
+// gf2Multiply returns the product of the matrix m,
+// whose columns are the elements of m, and the vector v
+func gf2Multiply(m []uint64, v uint64) (product uint64) {
+	for i := 0; v != 0 && i < len(m); i, v = i+1, v>>1 {
+		if v&1 != 0 {
+			product ^= m[i]
+		}
+	}
+	return product
+}
+
+// writePayloadParallel is like writePayload but the whole groups of p
+// are split into pieces which are encoded by jobs goroutines
+// and written in order.
+// p is also added to sum, which may be nil.
+func (pw *payloadWriter) writePayloadParallel(p []byte, jobs int, sum *checksum) error {
+	if sum == nil {
+		sum = &checksum{}
+	}
+	groupLen := pw.enc.groupLen()
+
+	// complete the pending group
+	if pw.nPending > 0 {
+		k := groupLen - pw.nPending
+		if k > len(p) {
+			k = len(p)
+		}
+		sum.update(p[:k])
+		if err := pw.writePayload(p[:k]); err != nil {
+			return err
+		}
+		p = p[k:]
+	}
+
+	whole := len(p) - len(p)%groupLen
+	pieceLen := (whole/jobs + groupLen - 1) / groupLen * groupLen
+	if len(pw.bufs) < jobs {
+		pw.bufs = make([][]byte, jobs)
+	}
+	sizes := make([]int, jobs)
+	partials := make([]uint64, jobs)
+	pieces := make([][]byte, jobs)
+
+	var wg sync.WaitGroup
+	for j := range pieces {
+		start, end := j*pieceLen, (j+1)*pieceLen
+		if start > whole {
+			start = whole
+		}
+		if end > whole {
+			end = whole
+		}
+		pieces[j] = p[start:end]
+
+		wg.Add(1)
+		go func(j int) {
+			defer wg.Done()
+			maxLen := pw.enc.EncodedPayloadMaxLen(len(pieces[j]))
+			if cap(pw.bufs[j]) < maxLen {
+				pw.bufs[j] = make([]byte, maxLen)
+			}
+			sizes[j] = pw.enc.encodeRaw(pw.bufs[j][:maxLen], pieces[j])
+			partials[j] = sum.partial(pieces[j])
+		}(j)
+	}
+	wg.Wait()
+
+	for j := range pieces {
+		sum.combine(partials[j], len(pieces[j]))
+		if _, err := pw.w.Write(pw.bufs[j][:sizes[j]]); err != nil {
+			return err
+		}
+	}
+
+	sum.update(p[whole:])
+	pw.nPending = copy(pw.pending[:], p[whole:])
+	return nil
+}
+
+// countChars returns the number of characters of the table in src
+func (enc *Encoding) countChars(src []byte) (chars int) {
+	var page int
+	for i := 0; i < len(src); {
+		_, size, ok := enc.nextChar(src[i:], &page)
+		if ok {
+			chars++
+		}
+		i += size
+	}
+	return chars
+}
+
+// decodeParallel is like decodePayload but src is split into pieces
+// of whole groups which are decoded by jobs goroutines.
+// The decoded data is also added to sum, which may be nil.
+func (enc *Encoding) decodeParallel(dst, src []byte, final bool, jobs int, sum *checksum) (n, m int, err error) {
+	if sum == nil {
+		sum = &checksum{}
+	}
+	groupChars := enc.encodedChars(enc.groupLen())
+
+	// split src into pieces which start with a character
+	bounds := make([]int, jobs+1)
+	for j := 1; j < jobs; j++ {
+		i := len(src) * j / jobs
+		for i < len(src) && !utf8.RuneStart(src[i]) {
+			i++
+		}
+		bounds[j] = i
+	}
+	bounds[jobs] = len(src)
+
+	// count the characters in each piece
+	chars := make([]int, jobs)
+	var wg sync.WaitGroup
+	for j := range chars {
+		wg.Add(1)
+		go func(j int) {
+			defer wg.Done()
+			chars[j] = enc.countChars(src[bounds[j]:bounds[j+1]])
+		}(j)
+	}
+	wg.Wait()
+
+	// move the start of each piece to the start of a group
+	// and find where its data starts in dst
+	offsets := make([]int, jobs)
+	var before int // characters before the start of the piece
+	for j := 1; j < jobs; j++ {
+		before += chars[j-1]
+		skip := (groupChars - before%groupChars) % groupChars
+		bounds[j], _, _ = enc.indexChars(src, bounds[j], skip)
+		// a piece which starts at the end of src is empty
+		// and the piece before it decodes the rest of src
+		if bounds[j] < len(src) {
+			offsets[j] = (before + skip) / groupChars * enc.groupLen()
+		}
+	}
+
+	type result struct {
+		n, m    int
+		err     error
+		partial uint64
+	}
+	results := make([]result, jobs)
+	for j := range results {
+		wg.Add(1)
+		go func(j int) {
+			defer wg.Done()
+			r := &results[j]
+			piece := src[bounds[j]:bounds[j+1]]
+			r.n, r.m, r.err = enc.decodePayload(dst[offsets[j]:], piece, final && bounds[j+1] == len(src))
+			r.partial = sum.partial(dst[offsets[j] : offsets[j]+r.n])
+		}(j)
+	}
+	wg.Wait()
+
+	for j, r := range results {
+		n += r.n
+		sum.combine(r.partial, r.n)
+		if r.m > 0 {
+			m = bounds[j] + r.m
+		}
+		if r.err != nil {
+			return n, m, moveError(r.err, bounds[j], utf8.RuneCount(src[:bounds[j]]))
+		}
+	}
+	return n, m, nil
+}
@@ -0,0 +1,286 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import "slices"
+
+// Profiles are built-in alphabets for platforms which
+// strip or mishandle some of the characters in V1Table.
+// The profile is recorded in the header of version 2 files,
+// so NewDecoder can decode them without being told the profile.
+const (
+	ProfileDefault            = 0 // V1Table, or ExtendedTable for 5-bit encoding
+	ProfileBidiSafe           = 1 // no bidi controls or deprecated format characters
+	ProfileBMPOnly            = 2 // no characters outside the basic multilingual plane
+	ProfileConservative       = 3 // only the most widely supported characters
+	ProfileVariationSelectors = 4 // VariationSelectorTable
+	ProfileTags               = 5 // TagTable
+)
+
+type profile struct {
+	name       string
+	table      []string
+	delimChar  rune
+	terminator rune // written after the checksum if not 0
+}
+
+var profiles = []profile{
+	ProfileDefault: {"default", ExtendedTable[:], V1DelimChar, 0},
+
+	// avoids U+202C and U+206A-U+206F which can change how text is rendered
+	ProfileBidiSafe: {"bidi-safe", []string{
+		"\xE2\x80\x8B",     //  0 U+200B
+		"\xE2\x80\x8C",     //  1 U+200C
+		"\xE2\x80\x8D",     //  2 U+200D
+		"\xE2\x81\xA0",     //  3 U+2060
+		"\xE2\x81\xA1",     //  4 U+2061
+		"\xE2\x81\xA2",     //  5 U+2062
+		"\xE2\x81\xA3",     //  6 U+2063
+		"\xE2\x81\xA4",     //  7 U+2064
+		"\xF0\x9D\x85\xB3", //  8 U+1D173
+		"\xF0\x9D\x85\xB4", //  9 U+1D174
+		"\xF0\x9D\x85\xB5", // 10 U+1D175
+		"\xF0\x9D\x85\xB6", // 11 U+1D176
+		"\xF0\x9D\x85\xB7", // 12 U+1D177
+		"\xF0\x9D\x85\xB8", // 13 U+1D178
+		"\xF0\x9D\x85\xB9", // 14 U+1D179
+		"\xF0\x9D\x85\xBA", // 15 U+1D17A
+	}, V1DelimChar, 0},
+
+	// replaces U+1D173 and U+1D174, which take two utf-16 code units,
+	// with spare characters from doc/unused-chars
+	ProfileBMPOnly: {"bmp-only", []string{
+		"\xE2\x80\xAC", //  0 U+202C
+		"\xE2\x80\x8C", //  1 U+200C
+		"\xE2\x80\x8D", //  2 U+200D
+		"\xE2\x81\xA0", //  3 U+2060
+		"\xE2\x81\xA1", //  4 U+2061
+		"\xE2\x81\xA2", //  5 U+2062
+		"\xE2\x81\xA3", //  6 U+2063
+		"\xE2\x81\xA4", //  7 U+2064
+		"\xE2\x81\xAA", //  8 U+206A
+		"\xE2\x81\xAB", //  9 U+206B
+		"\xE2\x81\xAC", // 10 U+206C
+		"\xE2\x81\xAD", // 11 U+206D
+		"\xE2\x81\xAE", // 12 U+206E
+		"\xE2\x81\xAF", // 13 U+206F
+		"\xE2\x80\x8E", // 14 U+200E
+		"\xE2\x80\xAA", // 15 U+202A
+	}, V1DelimChar, 0},
+
+	// only 2-bit encoding is supported
+	ProfileConservative: {"conservative", []string{
+		"\xE2\x80\x8B", //  0 U+200B
+		"\xE2\x80\x8C", //  1 U+200C
+		"\xE2\x80\x8D", //  2 U+200D
+		"\xE2\x81\xA0", //  3 U+2060
+	}, V1DelimChar, 0},
+
+	// every character is invisible after an emoji or other base character
+	ProfileVariationSelectors: {"variation-selectors", VariationSelectorTable[:], V1DelimChar, 0},
+
+	// platforms which strip other invisible characters often keep
+	// tag characters because flag emoji use them
+	ProfileTags: {"tags", TagTable[:], TagDelimChar, TagTerminator},
+}
+
+// delimChars are the delim chars of the built-in profiles,
+// one of which is the signature of every file using them
+var delimChars = func() (chars []rune) {
+	for _, p := range profiles {
+		if !slices.Contains(chars, p.delimChar) {
+			chars = append(chars, p.delimChar)
+		}
+	}
+	return chars
+}()
+
+// NewBidiSafeEncoding returns an Encoding using the bidi-safe profile
+func NewBidiSafeEncoding(encodingType, checksumType int) *Encoding {
+	return newProfileEncoding(ProfileBidiSafe, encodingType, checksumType)
+}
+
+// NewBMPOnlyEncoding returns an Encoding using the bmp-only profile
+func NewBMPOnlyEncoding(encodingType, checksumType int) *Encoding {
+	return newProfileEncoding(ProfileBMPOnly, encodingType, checksumType)
+}
+
+// NewConservativeEncoding returns an Encoding using the conservative profile
+func NewConservativeEncoding(encodingType, checksumType int) *Encoding {
+	return newProfileEncoding(ProfileConservative, encodingType, checksumType)
+}
+
+// NewVariationSelectorEncoding returns an Encoding
+// using 8-bit encoding and the variation-selectors profile.
+// Each byte is encoded as a single variation selector.
+func NewVariationSelectorEncoding(checksumType int) *Encoding {
+	return newProfileEncoding(ProfileVariationSelectors, 8, checksumType)
+}
+
+// NewTagEncoding returns an Encoding
+// using 6-bit encoding and the tags profile.
+// Every 3 bytes are encoded as 4 tag characters
+// and the file ends with TagTerminator.
+func NewTagEncoding(checksumType int) *Encoding {
+	return newProfileEncoding(ProfileTags, 6, checksumType)
+}
+
+// NewProfileEncoding returns an Encoding using the profile called name.
+// The name of each profile can be found with ProfileNames.
+// It panics if the profile doesn't exist or the settings are invalid.
+func NewProfileEncoding(name string, encodingType, checksumType int) *Encoding {
+	enc, err := NewProfileEncodingE(name, encodingType, checksumType)
+	if err != nil {
+		panic(err)
+	}
+	return enc
+}
+
+// NewProfileEncodingE is like NewProfileEncoding
+// but returns an InvalidEncodingError instead of panicking
+func NewProfileEncodingE(name string, encodingType, checksumType int) (*Encoding, error) {
+	for id, p := range profiles {
+		if p.name == name {
+			return newProfileEncodingE(id, encodingType, checksumType)
+		}
+	}
+
+	return nil, InvalidEncodingError{InvalidProfile: true}
+}
+
+// ProfileNames returns the names of the built-in profiles
+func ProfileNames() []string {
+	names := make([]string, len(profiles))
+	for i, p := range profiles {
+		names[i] = p.name
+	}
+	return names
+}
+
+// ValidProfile checks that the profile called name exists
+// and has enough characters for encodingType
+func ValidProfile(name string, encodingType int) error {
+	for _, p := range profiles {
+		if p.name == name {
+			if ValidEncoding(2, encodingType, 0) != nil {
+				return InvalidEncodingError{InvalidEncodingType: true}
+			}
+			if !tableSupports(p.table, encodingType) {
+				return InvalidEncodingError{UnsupportedTable: true, encodingType: encodingType}
+			}
+			return nil
+		}
+	}
+
+	return InvalidEncodingError{InvalidProfile: true}
+}
+
+// profileVersion returns the version of the header
+// used by profile id with encodingType.
+// The default profile and the bmp-only 4-bit encoding
+// use a version 1 header and everything else uses a version 2 header,
+// including 5-bit, 6-bit, 8-bit, and base-N encoding.
+func profileVersion(id, encodingType int) int {
+	if encodingType >= 5 || encodingType == RadixEncoding {
+		return 2
+	}
+	if id == ProfileDefault || id == ProfileBMPOnly && encodingType == 4 {
+		return 1
+	}
+	return 2
+}
+
+// encodingProfile returns the profile which NewEncoding
+// uses for encodingType instead of the default profile
+func encodingProfile(encodingType int) (id int, ok bool) {
+	switch encodingType {
+	case 6:
+		return ProfileTags, true
+	case 8:
+		return ProfileVariationSelectors, true
+	}
+	return ProfileDefault, false
+}
+
+// newProfileEncoding returns an Encoding using profile id
+func newProfileEncoding(id, encodingType, checksumType int) *Encoding {
+	enc, err := newProfileEncodingE(id, encodingType, checksumType)
+	if err != nil {
+		panic(err)
+	}
+	return enc
+}
+
+// newProfileEncodingE is like newProfileEncoding
+// but returns an error instead of panicking
+func newProfileEncodingE(id, encodingType, checksumType int) (*Encoding, error) {
+	p := profiles[id]
+	version := profileVersion(id, encodingType)
+	enc, err := NewCustomTableEncodingE(p.table, p.delimChar, version, encodingType, checksumType)
+	if err != nil {
+		return nil, err
+	}
+	enc.profile = id
+	return enc, nil
+}
+
+// DecodeEncoding takes an encoded header
+// with or without any delim chars and
+// returns an Encoding for the payload and checksum.
+// Unlike DecodeHeader, the header may use
+// any of the built-in profiles.
+func DecodeEncoding(src []byte) (*Encoding, error) {
+	var firstErr error
+
+	for id, p := range profiles {
+		v, e, c, headerProfile, err := decodeHeader(p.table, src)
+		if err == nil && headerProfile == id {
+			return headerEncoding(id, v, e, c)
+		}
+
+		// the error for the default profile is
+		// the most useful if no profile matches
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = InvalidEncodingError{InvalidProfile: true}
+	}
+	return nil, firstErr
+}
+
+// headerEncoding returns an Encoding using profile id
+// with the settings decoded from a header
+func headerEncoding(id, version, encodingType, checksumType int) (*Encoding, error) {
+	if id >= len(profiles) {
+		return nil, InvalidEncodingError{InvalidProfile: true}
+	}
+
+	p := profiles[id]
+	if !tableSupports(p.table, encodingType) {
+		return nil, InvalidEncodingError{InvalidEncodingType: true}
+	}
+
+	enc, err := NewCustomTableEncodingE(p.table, p.delimChar, version, encodingType, checksumType)
+	if err != nil {
+		return nil, err
+	}
+	enc.profile = id
+	return enc, nil
+}
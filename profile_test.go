@@ -0,0 +1,345 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yadayadajaychan/zwc"
+)
+
+// TestProfileEncoderAndDecoder tests that files encoded with
+// each profile can be decoded by NewDecoder
+func TestProfileEncoderAndDecoder(t *testing.T) {
+	testCases := []struct {
+		profile      string
+		encodingType int
+		checksumType int
+		version      int
+	}{
+		{"default", 4, 16, 1},
+		{"bidi-safe", 2, 0, 2},
+		{"bidi-safe", 3, 8, 2},
+		{"bidi-safe", 4, 32, 2},
+		{"bmp-only", 2, 16, 2},
+		{"bmp-only", 3, 32, 2},
+		{"bmp-only", 4, 8, 1},
+		{"conservative", 2, 8, 2},
+		{"variation-selectors", 2, 0, 2},
+		{"variation-selectors", 8, 16, 2},
+		{"tags", 2, 8, 2},
+		{"tags", 6, 32, 2},
+	}
+
+	data := []byte("longer piece of data")
+
+	for i, tc := range testCases {
+		enc := zwc.NewProfileEncoding(tc.profile, tc.encodingType, tc.checksumType)
+		if enc.Version() != tc.version {
+			t.Errorf("testcase %v: Expected version %v, got %v", i, tc.version, enc.Version())
+		}
+		if enc.Profile() != tc.profile {
+			t.Errorf("testcase %v: Expected profile %v, got %v", i, tc.profile, enc.Profile())
+		}
+
+		var b bytes.Buffer
+		e := zwc.NewEncoder(enc, &b)
+		if _, err := e.Write(data); err != nil {
+			t.Error("testcase", i, ": Write returned an error of", err)
+		}
+		if err := e.Close(); err != nil {
+			t.Error("testcase", i, ": Close returned an error of", err)
+		}
+
+		encoded := b.String()
+		output, err := io.ReadAll(zwc.NewDecoder(&b))
+		if err != nil {
+			t.Error("testcase", i, ": Read returned an error of", err)
+		}
+		if string(output) != string(data) {
+			t.Errorf("testcase %v: Expected %q, got %q", i, data, output)
+		}
+
+		header := strings.Split(encoded, string(enc.DelimCharAsUTF8()))[1]
+		decoded, err := zwc.DecodeEncoding([]byte(header))
+		if err != nil {
+			t.Error("testcase", i, ": DecodeEncoding returned an error of", err)
+			continue
+		}
+		if decoded.Profile() != tc.profile ||
+			decoded.EncodingType() != tc.encodingType ||
+			decoded.ChecksumType() != tc.checksumType {
+			t.Errorf("testcase %v: Expected %v %v %v, got %v %v %v", i,
+				tc.profile, tc.encodingType, tc.checksumType,
+				decoded.Profile(), decoded.EncodingType(), decoded.ChecksumType())
+		}
+	}
+}
+
+// TestValidProfile tests ValidProfile
+func TestValidProfile(t *testing.T) {
+	testCases := []struct {
+		profile      string
+		encodingType int
+		valid        bool
+	}{
+		{"default", 4, true},
+		{"bidi-safe", 4, true},
+		{"bmp-only", 3, true},
+		{"bmp-only", 4, true},
+		{"conservative", 2, true},
+		{"conservative", 3, false},
+		{"variation-selectors", 8, true},
+		{"default", 8, false},
+		{"tags", 6, true},
+		{"bidi-safe", 6, false},
+		{"unknown", 2, false},
+	}
+
+	for i, tc := range testCases {
+		err := zwc.ValidProfile(tc.profile, tc.encodingType)
+		if (err == nil) != tc.valid {
+			t.Errorf("testcase %v: Expected valid %v, got error %v", i, tc.valid, err)
+		}
+	}
+}
+
+// TestBMPOnly4Bit tests that the bmp-only 4-bit encoding
+// stays inside the basic multilingual plane and
+// uses its own value in a version 1 header
+func TestBMPOnly4Bit(t *testing.T) {
+	enc := zwc.NewBMPOnlyEncoding(4, 32)
+
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	dst := make([]byte, enc.EncodedMaxLen(len(data)))
+	dst = dst[:enc.Encode(dst, data)]
+	for _, r := range string(dst) {
+		if r > 0xFFFF {
+			t.Errorf("Expected only bmp characters, got U+%04X", r)
+			break
+		}
+	}
+
+	// v1, 4-bit bmp-only, crc-32
+	header := dst[len(string(zwc.V1DelimChar)):][:enc.EncodedHeaderLen()]
+	expected := "\xE2\x80\xAC" +
+		"\xE2\x81\xA0" +
+		"\xE2\x81\xA0" +
+		"\xE2\x81\xA0"
+	if string(header) != expected {
+		t.Errorf("Expected %q, got %q", expected, header)
+	}
+
+	// the default table can't decode the payload
+	if _, _, _, err := zwc.DecodeHeader(header); err == nil {
+		t.Error("Expected DecodeHeader to reject bmp-only 4-bit header")
+	}
+
+	output, err := io.ReadAll(zwc.NewDecoder(bytes.NewReader(dst)))
+	if err != nil {
+		t.Error("Read returned an error of", err)
+	}
+	if !bytes.Equal(output, data) {
+		t.Errorf("Expected %q, got %q", data, output)
+	}
+}
+
+// TestVariationSelectorEncoding tests that 8-bit encoding
+// encodes each byte as one variation selector
+func TestVariationSelectorEncoding(t *testing.T) {
+	enc := zwc.NewEncoding(2, 8, 32)
+	if enc.Profile() != "variation-selectors" {
+		t.Errorf("Expected variation-selectors, got %v", enc.Profile())
+	}
+
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	dst := make([]byte, enc.EncodedPayloadMaxLen(len(data)))
+	dst = dst[:enc.EncodePayload(dst, data)]
+	if n := utf8.RuneCount(dst); n != len(data) {
+		t.Errorf("Expected %v characters, got %v", len(data), n)
+	}
+	for _, r := range string(dst) {
+		if !unicode.Is(unicode.Variation_Selector, r) {
+			t.Errorf("Expected variation selector, got U+%04X", r)
+			break
+		}
+	}
+
+	// a whole file attached to an emoji
+	var b bytes.Buffer
+	b.WriteString("\U0001F600")
+	e := zwc.NewEncoder(zwc.NewVariationSelectorEncoding(32), &b)
+	e.Write(data)
+	e.Close()
+
+	output, err := io.ReadAll(zwc.NewDecoder(&b))
+	if err != nil {
+		t.Error("Read returned an error of", err)
+	}
+	if !bytes.Equal(output, data) {
+		t.Errorf("Expected %q, got %q", data, output)
+	}
+
+	// the settings can be passed back to NewEncoding
+	header := make([]byte, enc.EncodedHeaderLen())
+	header = header[:enc.EncodeHeader(header)]
+	if v, e, c, err := zwc.DecodeHeader(header); err != nil || v != 2 || e != 8 || c != 32 {
+		t.Errorf("Expected 2, 8, 32, got %v, %v, %v with error %v", v, e, c, err)
+	}
+
+	b.Reset()
+	e = zwc.NewEncoder(enc, &b)
+	e.Write(data)
+	e.Close()
+	if v, e, c, err := zwc.DecodeHeaderFromReader(&b); err != nil || v != 2 || e != 8 || c != 32 {
+		t.Errorf("Expected 2, 8, 32, got %v, %v, %v with error %v", v, e, c, err)
+	}
+
+	// 8-bit encoding requires a version 2 header
+	if err := zwc.ValidEncoding(1, 8, 0); err == nil {
+		t.Error("Expected error for version 1 with encoding 8")
+	}
+}
+
+// TestTagEncoding tests that 6-bit encoding
+// uses only tag characters and ends with TagTerminator
+func TestTagEncoding(t *testing.T) {
+	data := []byte("longer piece of data")
+
+	for length := 0; length <= len(data); length++ {
+		enc := zwc.NewEncoding(2, 6, 16)
+		if enc.Profile() != "tags" {
+			t.Errorf("Expected tags, got %v", enc.Profile())
+		}
+
+		// write one byte at a time after a flag emoji
+		var b bytes.Buffer
+		b.WriteString("\U0001F3F4")
+		e := zwc.NewEncoder(enc, &b)
+		e.Write(nil)
+		for i := 0; i < length; i++ {
+			e.Write(data[i : i+1])
+		}
+		if err := e.Close(); err != nil {
+			t.Error("Close returned an error of", err)
+		}
+
+		encoded := []rune(b.String())[1:]
+		for _, r := range encoded {
+			if r < 0xE0000 || r > 0xE007F {
+				t.Errorf("length %v: Expected tag character, got U+%04X", length, r)
+				break
+			}
+		}
+		if encoded[len(encoded)-1] != zwc.TagTerminator {
+			t.Errorf("length %v: Expected TagTerminator at end", length)
+		}
+
+		// read one byte at a time
+		d := zwc.NewDecoder(iotest.OneByteReader(&b))
+		var decoded []byte
+		p := make([]byte, 1)
+		for {
+			n, err := d.Read(p)
+			decoded = append(decoded, p[:n]...)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("length %v: Read returned an error of %v", length, err)
+				break
+			}
+		}
+		if !bytes.Equal(decoded, data[:length]) {
+			t.Errorf("Expected %q, got %q", data[:length], decoded)
+		}
+	}
+
+	// 3 bytes are encoded as 4 characters
+	enc := zwc.NewTagEncoding(0)
+	dst := make([]byte, enc.EncodedPayloadMaxLen(3))
+	n := enc.EncodePayload(dst, []byte{0x04, 0x20, 0xC4})
+	expected := zwc.TagTable[1] + zwc.TagTable[2] + zwc.TagTable[3] + zwc.TagTable[4]
+	if string(dst[:n]) != expected {
+		t.Errorf("Expected %q, got %q", expected, dst[:n])
+	}
+
+	// 1 character doesn't end at a byte boundary
+	if _, _, err := enc.DecodePayload(make([]byte, 1), []byte(zwc.TagTable[0])); err == nil {
+		t.Error("Expected error for incomplete byte")
+	}
+
+	// the header has its own encoding value
+	header := make([]byte, enc.EncodedHeaderLen())
+	header = header[:enc.EncodeHeader(header)]
+	if _, e, _, err := zwc.DecodeCustomHeader(zwc.TagTable[:], header); err != nil || e != 6 {
+		t.Errorf("Expected encoding 6, got %v with error %v", e, err)
+	}
+
+	// the settings can be passed back to NewEncoding
+	if v, e, c, err := zwc.DecodeHeader(header); err != nil || v != 2 || e != 6 || c != 0 {
+		t.Errorf("Expected 2, 6, 0, got %v, %v, %v with error %v", v, e, c, err)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("\U0001F3F4")
+	e := zwc.NewEncoder(zwc.NewEncoding(2, 6, 16), &b)
+	e.Write(data)
+	e.Close()
+	if v, e, c, err := zwc.DecodeHeaderFromReader(&b); err != nil || v != 2 || e != 6 || c != 16 {
+		t.Errorf("Expected 2, 6, 16, got %v, %v, %v with error %v", v, e, c, err)
+	}
+}
+
+// TestDecodeEncodingV2Header tests that version 2 headers
+// with a corrupt second byte are rejected
+func TestDecodeEncodingV2Header(t *testing.T) {
+	enc := zwc.NewBidiSafeEncoding(3, 16)
+	header := make([]byte, enc.EncodedHeaderLen())
+	header = header[:enc.EncodeHeader(header)]
+
+	if _, err := zwc.DecodeEncoding(header); err != nil {
+		t.Error("DecodeEncoding returned an error of", err)
+	}
+
+	// the profile is in the second byte of the header
+	if _, err := zwc.DecodeEncoding(header[:len(header)/2]); err == nil {
+		t.Error("Expected error for truncated version 2 header")
+	}
+
+	// swap the last two characters of the header
+	runes := []rune(string(header))
+	runes[6], runes[7] = runes[7], runes[6]
+	if runes[6] != runes[7] {
+		if _, err := zwc.DecodeEncoding([]byte(string(runes))); err == nil {
+			t.Error("Expected error for corrupt version 2 header")
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// rangeBufferSize is the size of the buffer used by DecodeRangeFromReader
+const rangeBufferSize = 64 << 10
+
+// rangeIndexGroups is the number of groups between
+// the positions recorded by a RangeIndex
+const rangeIndexGroups = 256
+
+// DecodeRange decodes n bytes of the data in src starting at byte off
+// without decoding the data before it.
+// Like Decode, src is the data + delim + checksum after the header.
+// The checksum isn't checked since only part of the data is decoded.
+//
+// If every character of the table has the same length,
+// such as the characters of 2-bit and 3-bit encoding,
+// the position of the range in src is calculated,
+// so the payload must only contain characters of the table
+// as it does when it is written by Encode or an Encoder.
+// Otherwise, such as for 4-bit encoding,
+// the characters before the range are counted one by one to find it.
+// This is a linear scan, so it takes longer the larger off is,
+// but it is still much faster than decoding them.
+// To decode many ranges of the same src, use NewRangeIndex.
+//
+// If the data ends before off+n, the data up to the end
+// is returned with io.EOF.
+// DecodeRange panics if off or n is negative.
+func (enc *Encoding) DecodeRange(src []byte, off, n int) ([]byte, error) {
+	if off < 0 || n < 0 {
+		panic("zwc: negative range")
+	}
+
+	// the data can't be longer than maxLen,
+	// which also keeps off+n from overflowing
+	maxLen := enc.DecodedPayloadMaxLen(len(src))
+	if off > maxLen {
+		return nil, io.EOF
+	} else if n > maxLen {
+		n = maxLen + 1
+	}
+
+	groupLen := enc.groupLen()
+	groupChars := enc.encodedChars(groupLen)
+	first := off / groupLen                     // group with the first byte of the range
+	last := (off + n + groupLen - 1) / groupLen // group after the last byte of the range
+
+	// find the characters of the groups in the range
+	var start, end, runes int
+	payload := src
+	if enc.minCharLen == enc.maxCharLen {
+		charLen := enc.minCharLen
+		start, end, runes = first*groupChars*charLen, last*groupChars*charLen, first*groupChars
+
+		// only src up to the end of the range is searched for the delim char
+		i := bytes.IndexRune(src[:clamp(end, len(src))], enc.delimChar)
+		if i < 0 && end > len(src) {
+			return nil, errorAt(CorruptPayloadError{NoDelimChar: true}, src, len(src))
+		} else if i >= 0 {
+			payload = src[:i]
+		}
+		start, end = clamp(start, len(payload)), clamp(end, len(payload))
+	} else {
+		i := bytes.IndexRune(src, enc.delimChar)
+		if i < 0 {
+			return nil, errorAt(CorruptPayloadError{NoDelimChar: true}, src, len(src))
+		}
+		payload = src[:i]
+
+		start, runes, _ = enc.indexChars(payload, 0, first*groupChars)
+		end, _, _ = enc.indexChars(payload, start, (last-first)*groupChars)
+	}
+
+	return enc.decodeGroups(payload[start:end], position{start, runes}, off-first*groupLen, n)
+}
+
+// A RangeIndex decodes ranges of the data in src like DecodeRange
+// but only counts the characters before a range
+// from the nearest position recorded when it was created.
+type RangeIndex struct {
+	enc       *Encoding
+	src       []byte
+	payload   []byte     // src before the delim char
+	positions []position // position of every rangeIndexGroups groups
+}
+
+// NewRangeIndex returns a RangeIndex of src, which is the same as for DecodeRange.
+// If the characters of the table have different lengths,
+// such as for 4-bit encoding, the payload is scanned once
+// to record the position of every 256 groups of characters,
+// so later ranges only count the characters after the nearest of them.
+// Otherwise the position of a range is calculated as it is by DecodeRange.
+// A CorruptPayloadError is returned if src doesn't contain the delim char.
+func (enc *Encoding) NewRangeIndex(src []byte) (*RangeIndex, error) {
+	i := bytes.IndexRune(src, enc.delimChar)
+	if i < 0 {
+		return nil, errorAt(CorruptPayloadError{NoDelimChar: true}, src, len(src))
+	}
+
+	x := &RangeIndex{enc: enc, src: src, payload: src[:i]}
+	if enc.minCharLen == enc.maxCharLen {
+		return x, nil
+	}
+
+	step := rangeIndexGroups * enc.encodedChars(enc.groupLen())
+	var pos position
+	for {
+		x.positions = append(x.positions, pos)
+		index, runes, chars := enc.indexChars(x.payload, pos.offset, step)
+		if chars < step {
+			break
+		}
+		pos = position{index, pos.runeOffset + runes}
+	}
+	return x, nil
+}
+
+// DecodeRange is like the DecodeRange method of Encoding
+// but decodes the src of the RangeIndex.
+func (x *RangeIndex) DecodeRange(off, n int) ([]byte, error) {
+	enc := x.enc
+	if x.positions == nil {
+		return enc.DecodeRange(x.src, off, n)
+	}
+	if off < 0 || n < 0 {
+		panic("zwc: negative range")
+	}
+
+	maxLen := enc.DecodedPayloadMaxLen(len(x.payload))
+	if off > maxLen {
+		return nil, io.EOF
+	} else if n > maxLen {
+		n = maxLen + 1
+	}
+
+	groupLen := enc.groupLen()
+	groupChars := enc.encodedChars(groupLen)
+	first := off / groupLen                     // group with the first byte of the range
+	last := (off + n + groupLen - 1) / groupLen // group after the last byte of the range
+
+	// count the characters from the nearest recorded position
+	entry := first / rangeIndexGroups
+	if entry >= len(x.positions) {
+		entry = len(x.positions) - 1
+	}
+	from := x.positions[entry]
+	start, runes, _ := enc.indexChars(x.payload, from.offset, (first-entry*rangeIndexGroups)*groupChars)
+	end, _, _ := enc.indexChars(x.payload, start, (last-first)*groupChars)
+
+	return enc.decodeGroups(x.payload[start:end], position{start, from.runeOffset + runes}, off-first*groupLen, n)
+}
+
+// DecodeRangeFromReader is like DecodeRange but reads src from r.
+// The text before the range is read and discarded,
+// so only the characters of the range are kept in memory.
+// Even if every character of the table has the same length,
+// the text before the range is read to find the delim char,
+// but the characters aren't counted.
+//
+// r is read up to the end of the range,
+// so unlike DecodeRange, a missing delim char after the range
+// isn't an error.
+func (enc *Encoding) DecodeRangeFromReader(r io.Reader, off, n int) ([]byte, error) {
+	if off < 0 || n < 0 {
+		panic("zwc: negative range")
+	}
+
+	groupLen := int64(enc.groupLen())
+	groupChars := int64(enc.encodedChars(enc.groupLen()))
+
+	// each group takes at most groupChars*utf8.UTFMax bytes of text,
+	// so a range after maxGroups can't be read,
+	// which also keeps the number of characters from overflowing
+	maxGroups := math.MaxInt64 / (2 * groupChars * utf8.UTFMax)
+	first := int64(off) / groupLen // group with the first byte of the range
+	if first > maxGroups {
+		return nil, io.EOF
+	}
+	length := int64(n)
+	if length > maxGroups*groupLen {
+		length = maxGroups * groupLen
+	}
+	last := (int64(off) + length + groupLen - 1) / groupLen // group after the last byte of the range
+
+	br := bufio.NewReaderSize(r, rangeBufferSize)
+	var pos position
+	if delim, err := enc.readChars(br, first*groupChars, &pos, nil); err != nil {
+		return nil, err
+	} else if delim { // the data ends before the range
+		return []byte{}, io.EOF
+	}
+
+	start := pos
+	var payload []byte
+	if _, err := enc.readChars(br, (last-first)*groupChars, &pos, &payload); err != nil {
+		return nil, err
+	}
+
+	return enc.decodeGroups(payload, start, int(int64(off)-first*groupLen), n)
+}
+
+// readChars reads k characters of the table from br
+// and adds the position of the text read to pos.
+// It stops before the delim char and reports whether it was found.
+// If dst isn't nil, the text is appended to it.
+// If br ends before the delim char, a CorruptPayloadError is returned.
+//
+// Like DecodeRange, if every character of the table has the same length,
+// the text is assumed to only contain characters of the table.
+func (enc *Encoding) readChars(br *bufio.Reader, k int64, pos *position, dst *[]byte) (delim bool, err error) {
+	for k > 0 {
+		buf, err := br.Peek(br.Size())
+		if len(buf) == 0 && err == io.EOF {
+			return false, moveError(CorruptPayloadError{NoDelimChar: true}, pos.offset, pos.runeOffset)
+		} else if err != nil && err != io.EOF {
+			return false, err
+		}
+		if err == nil {
+			buf = buf[:fullRunes(buf)]
+		}
+
+		j := bytes.IndexRune(buf, enc.delimChar)
+		if j >= 0 {
+			buf = buf[:j]
+		}
+
+		var i, runes int
+		if enc.minCharLen == enc.maxCharLen {
+			i = len(buf)
+			if int64(i) > k*int64(enc.minCharLen) {
+				i = int(k * int64(enc.minCharLen))
+			}
+			runes = i / enc.minCharLen
+			k -= int64(runes)
+		} else {
+			var chars int
+			i, runes, chars = enc.indexChars(buf, 0, int(min64(k, int64(len(buf)))))
+			k -= int64(chars)
+		}
+
+		if dst != nil {
+			*dst = append(*dst, buf[:i]...)
+		}
+		pos.offset += i
+		pos.runeOffset += runes
+		br.Discard(i)
+
+		if k > 0 && j >= 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// decodeGroups decodes the groups of the range in payload,
+// which starts at start, and returns n bytes of them after skip
+func (enc *Encoding) decodeGroups(payload []byte, start position, skip, n int) ([]byte, error) {
+	// the range is made of whole groups, so it is decoded like a whole payload
+	dst := make([]byte, enc.DecodedPayloadMaxLen(len(payload)))
+	k, _, err := enc.decodePayload(dst, payload, true)
+	if err != nil {
+		return nil, moveError(err, start.offset, start.runeOffset)
+	}
+
+	// remove the bytes of the groups which aren't in the range
+	if skip > k || n > k-skip {
+		return dst[clamp(skip, k):k], io.EOF
+	}
+	return dst[skip : skip+n], nil
+}
+
+// indexChars returns the index in src after k characters
+// of the table from i, the number of characters from i to the index,
+// including characters which aren't in the table,
+// and the number of characters of the table, which is less than k
+// if src ends first
+func (enc *Encoding) indexChars(src []byte, i, k int) (index, runes, chars int) {
+	var page int
+	for chars < k && i < len(src) {
+		_, size, ok := enc.nextChar(src[i:], &page)
+		if ok {
+			chars++
+		}
+		i += size
+		runes++
+	}
+	return i, runes, chars
+}
+
+// fullRunes returns the length of p without
+// an incomplete character at the end
+func fullRunes(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
+
+// min64 returns the smaller of a and b
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// clamp returns i if it is less than n and n otherwise
+func clamp(i, n int) int {
+	if i > n {
+		return n
+	}
+	return i
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// SpaceBitsPerChar is the number of bits
+// hidden in each space of the message
+const SpaceBitsPerChar = 3
+
+// SpaceTable holds the spaces which replace U+0020.
+// The value of each space is its index.
+var SpaceTable = [1 << SpaceBitsPerChar]rune{
+	'\u2004', // THREE-PER-EM SPACE
+	'\u2005', // FOUR-PER-EM SPACE
+	'\u2006', // SIX-PER-EM SPACE
+	'\u2008', // PUNCTUATION SPACE
+	'\u2009', // THIN SPACE
+	'\u200A', // HAIR SPACE
+	'\u202F', // NARROW NO-BREAK SPACE
+	'\u205F', // MEDIUM MATHEMATICAL SPACE
+}
+
+// spaceValue returns the value of r in SpaceTable
+func spaceValue(r rune) (byte, bool) {
+	for i, v := range SpaceTable {
+		if v == r {
+			return byte(i), true
+		}
+	}
+	return 0, false
+}
+
+// SpaceCarrier hides data by replacing the spaces (U+0020)
+// of the message with the spaces in SpaceTable.
+// Each space holds SpaceBitsPerChar bits.
+// Spaces which aren't needed are left unchanged.
+var SpaceCarrier = NewBitCarrier(spaces{})
+
+type spaces struct{}
+
+func (spaces) Bits(message []byte) int {
+	return bytes.Count(message, []byte(" ")) * SpaceBitsPerChar
+}
+
+func (spaces) Embed(message, bits []byte) []byte {
+	var text bytes.Buffer
+	for _, c := range message {
+		if c != ' ' || len(bits) == 0 {
+			text.WriteByte(c)
+			continue
+		}
+
+		// the last space may need fewer bits, so it is padded with 0s
+		var v byte
+		for i := 0; i < SpaceBitsPerChar; i++ {
+			v <<= 1
+			if len(bits) > 0 {
+				v |= bits[0]
+				bits = bits[1:]
+			}
+		}
+		text.WriteRune(SpaceTable[v])
+	}
+
+	return text.Bytes()
+}
+
+// Extract replaces every space from SpaceTable with U+0020
+func (spaces) Extract(text []byte) (bits, message []byte) {
+	var m bytes.Buffer
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		if v, ok := spaceValue(r); ok {
+			for i := SpaceBitsPerChar - 1; i >= 0; i-- {
+				bits = append(bits, v>>i&1)
+			}
+			m.WriteByte(' ')
+		} else {
+			m.Write(text[:size])
+		}
+		text = text[size:]
+	}
+
+	return bits, m.Bytes()
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"unicode/utf8"
+)
+
+// StreamOptions are the options of EncodeStream and DecodeStream
+type StreamOptions struct {
+	// Progress is called after each read from the input
+	// with the number of bytes read so far and the expected total,
+	// which is -1 if it isn't known.
+	// The input is the data for EncodeStream and the text for DecodeStream.
+	Progress func(done, total int64)
+
+	// Total is the expected number of bytes of input.
+	// If it is 0, it is the length of the input if the input has a Len method,
+	// such as a *bytes.Reader, or the rest of the input if it is a regular file.
+	Total int64
+
+	// Jobs is passed to SetJobs of the Encoder or Decoder
+	Jobs int
+
+	// Limits are passed to SetOptions of the Decoder of DecodeStream
+	Limits DecoderOptions
+
+	// Cat makes DecodeStream decode every file in the text like NewCatDecoder
+	// if its encoding is nil
+	Cat bool
+}
+
+// EncodeStream encodes data with enc and writes the ZWC file to dst
+// after the first character of message, followed by the rest of message.
+// If message is nil, only the ZWC file is written.
+// It returns the number of bytes of data encoded and the checksum.
+// If ctx is done before data has been encoded, ctx.Err() is returned
+// and the ZWC file is left incomplete.
+func EncodeStream(ctx context.Context, enc *Encoding, dst io.Writer, data, message io.Reader, opts StreamOptions) (n int64, crc uint64, err error) {
+	if message != nil {
+		message = &progressReader{ctx: ctx, r: message}
+		if err := copyFirstChar(dst, message); err != nil && err != io.EOF {
+			return 0, 0, err
+		}
+	}
+
+	e := NewEncoder(enc, dst)
+	e.SetJobs(opts.Jobs)
+
+	// the header is written even if there is no data
+	if _, err := e.Write(nil); err != nil {
+		return 0, 0, err
+	}
+
+	n, err = e.ReadFrom(newProgressReader(ctx, data, opts))
+	if err != nil {
+		return n, 0, err
+	}
+	if err := e.Close(); err != nil {
+		return n, 0, err
+	}
+
+	if message != nil {
+		if _, err := io.Copy(dst, message); err != nil {
+			return n, e.Checksum(), err
+		}
+	}
+	return n, e.Checksum(), nil
+}
+
+// DecodeStream decodes the ZWC file in text and writes the data to dst.
+// If enc is nil, the encoding is decoded from the header like NewDecoder,
+// or from the header of each file like NewCatDecoder if opts.Cat is set.
+// Otherwise the header must be decoded beforehand like NewCustomDecoder.
+// It returns the number of bytes of data decoded and the checksum
+// of the last file, which is only valid if err is nil.
+// If ctx is done before the file has been decoded, ctx.Err() is returned.
+func DecodeStream(ctx context.Context, enc *Encoding, dst io.Writer, text io.Reader, opts StreamOptions) (n int64, crc uint64, err error) {
+	r := newProgressReader(ctx, text, opts)
+
+	var d *Decoder
+	if enc == nil && opts.Cat {
+		d = NewCatDecoder(r)
+	} else if enc == nil {
+		d = NewDecoder(r)
+	} else {
+		d = NewCustomDecoder(enc, r)
+	}
+	d.SetJobs(opts.Jobs)
+	d.SetOptions(opts.Limits)
+
+	n, err = d.WriteTo(dst)
+	return n, d.Checksum(), err
+}
+
+// A progressReader reads from r until ctx is done
+// and passes the number of bytes read to progress
+type progressReader struct {
+	ctx         context.Context
+	r           io.Reader
+	done, total int64
+	progress    func(done, total int64) // may be nil
+}
+
+// newProgressReader returns a progressReader for r
+// which uses the Progress and Total of opts
+func newProgressReader(ctx context.Context, r io.Reader, opts StreamOptions) *progressReader {
+	total := opts.Total
+	if total == 0 {
+		total = inputSize(r)
+	}
+	return &progressReader{ctx: ctx, r: r, total: total, progress: opts.Progress}
+}
+
+func (pr *progressReader) Read(p []byte) (n int, err error) {
+	if err := pr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err = pr.r.Read(p)
+	if n > 0 && pr.progress != nil {
+		pr.done += int64(n)
+		pr.progress(pr.done, pr.total)
+	}
+	return n, err
+}
+
+// inputSize returns the number of bytes left in r, or -1 if it isn't known
+func inputSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case interface{ Stat() (fs.FileInfo, error) }:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+
+		size := info.Size()
+		if s, ok := r.(io.Seeker); ok {
+			if off, err := s.Seek(0, io.SeekCurrent); err == nil {
+				size -= off
+			}
+		}
+		return size
+	}
+	return -1
+}
+
+// copyFirstChar copies the first character of r to w,
+// reading r one byte at a time so nothing after it is read
+func copyFirstChar(w io.Writer, r io.Reader) error {
+	var char [utf8.UTFMax]byte
+	var n int
+	for n == 0 || n < len(char) && !utf8.FullRune(char[:n]) {
+		k, err := r.Read(char[n : n+1])
+		n += k
+		if err == io.EOF && n > 0 {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(char[:n])
+	return err
+}
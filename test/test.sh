@@ -32,6 +32,22 @@ do
 
 	## text from stdin
 	cat ${dir}/*.txt | ./zwc decode | diff -q - ${dir}/*.data
+
+	# raw encode and decode
+	./zwc encode -r -m ${dir}/*.mesg -d ${dir}/*.data -e $ENCODING | ./zwc decode -r -e $ENCODING | diff -q - ${dir}/*.data
+
+	# 5-bit, 6-bit, 8-bit, and base-N encode and decode
+	./zwc encode -m ${dir}/*.mesg -d ${dir}/*.data -c $CHECKSUM -e 5 | ./zwc decode | diff -q - ${dir}/*.data
+	./zwc encode -r -m ${dir}/*.mesg -d ${dir}/*.data -e 5 | ./zwc decode -r -e 5 | diff -q - ${dir}/*.data
+	./zwc encode -m ${dir}/*.mesg -d ${dir}/*.data -c $CHECKSUM -e 8 | ./zwc decode | diff -q - ${dir}/*.data
+	./zwc encode -r -m ${dir}/*.mesg -d ${dir}/*.data -e 8 | ./zwc decode -r -e 8 | diff -q - ${dir}/*.data
+	./zwc encode -m ${dir}/*.mesg -d ${dir}/*.data -c $CHECKSUM -e 6 | ./zwc decode | diff -q - ${dir}/*.data
+	./zwc encode -r -m ${dir}/*.mesg -d ${dir}/*.data -e 6 | ./zwc decode -r -e 6 | diff -q - ${dir}/*.data
+	./zwc encode -m ${dir}/*.mesg -d ${dir}/*.data -c $CHECKSUM -e 0 | ./zwc decode | diff -q - ${dir}/*.data
+	./zwc encode -r -m ${dir}/*.mesg -d ${dir}/*.data -e 0 | ./zwc decode -r -e 0 | diff -q - ${dir}/*.data
+
+	# profile encode and decode
+	./zwc encode -p bidi-safe -m ${dir}/*.mesg -d ${dir}/*.data -c $CHECKSUM -e $ENCODING | ./zwc decode | diff -q - ${dir}/*.data
 done
 
 for dir in no-message/*/
@@ -51,6 +67,111 @@ do
 	cat ${dir}/*.txt | ./zwc decode | diff -q - ${dir}/*.data
 done
 
+# carriers need a message with more lines and spaces than the test cases
+seq 1 40 | sed 's/$/ a b c d e f g h i j/' > carrier.mesg
+for dir in vanilla/01/ vanilla/02/
+do
+	source ${dir}/parameters
+
+	# whitespace carrier
+	./zwc encode -C whitespace -m carrier.mesg -d ${dir}/*.data -c $CHECKSUM -e $ENCODING | ./zwc decode | diff -q - ${dir}/*.data
+	./zwc encode -C whitespace -m carrier.mesg -d ${dir}/*.data -c $CHECKSUM -e $ENCODING | ./zwc decode -C whitespace -m | diff -q - carrier.mesg
+
+	# spaces carrier
+	./zwc encode -C spaces -m carrier.mesg -d ${dir}/*.data -c $CHECKSUM -e $ENCODING | ./zwc decode | diff -q - ${dir}/*.data
+	./zwc encode -C spaces -m carrier.mesg -d ${dir}/*.data -c $CHECKSUM -e $ENCODING | ./zwc decode -C spaces -m | diff -q - carrier.mesg
+
+	# homoglyphs carrier
+	./zwc encode -C homoglyphs -m carrier.mesg -d ${dir}/*.data -c $CHECKSUM -e $ENCODING | ./zwc decode | diff -q - ${dir}/*.data
+	./zwc encode -C homoglyphs -m carrier.mesg -d ${dir}/*.data -c $CHECKSUM -e $ENCODING | ./zwc decode -C homoglyphs -m | diff -q - carrier.mesg
+done
+
+# carriers read the whole text, which must be within the scan limit
+./zwc encode -C spaces -m carrier.mesg -d vanilla/01/*.data > carrier.txt
+if ./zwc decode -t carrier.txt --max-scan-bytes 100 > /dev/null 2>&1 ||
+   ./zwc decode -t carrier.txt -C spaces --max-scan-bytes 100 > /dev/null 2>&1 ||
+   ./zwc decode -t carrier.txt -C spaces --max-payload-bytes 1 > /dev/null 2>&1; then
+	echo "test.sh: limits weren't enforced for carriers"
+	exit 1
+fi
+rm carrier.mesg carrier.txt
+
+# probe through a platform which strips U+200C and U+2061
+./zwc probe generate | sed 's/\xe2\x80\x8c//; s/\xe2\x81\xa1//' | ./zwc probe analyze -q > probe.json
+if grep -q -e "U+200C" -e "U+2061" probe.json; then
+	echo "test.sh: probe analyze used a stripped character"
+	exit 1
+fi
+test $(grep -c '"U+' probe.json) -eq 17 # delim and 16 characters
+./zwc encode -A probe.json -m vanilla/01/*.mesg -d vanilla/01/*.data -e 4 | ./zwc decode -A probe.json | diff -q - vanilla/01/*.data
+rm probe.json
+
+# alphabet check warns about characters which may be visible
+echo '{"delim": "U+034F", "table": ["U+200B", "U+202E", "U+200D", "a"]}' > lint.json
+./zwc alphabet check lint.json > lint.out
+grep -q "1 .*RIGHT-TO-LEFT OVERRIDE" lint.out
+grep -q "warning: bidi control (class RLO)" lint.out
+grep -q "warning: not a Default_Ignorable_Code_Point" lint.out
+grep -q "0 error(s), 5 warning(s)" lint.out
+
+## errors make it fail
+echo '{"delim": "U+034F", "table": ["U+200B", "U+200C", "U+200B", "U+2060"]}' > lint.json
+if ./zwc alphabet check lint.json > lint.out; then
+	echo "test.sh: alphabet check didn't fail for a duplicate character"
+	exit 1
+fi
+grep -q "error: invalid alphabet: duplicate character in table at index 2" lint.out
+rm lint.json lint.out
+
+# parallel encode and decode of large data
+head -c 2000000 /dev/urandom > jobs.data
+./zwc encode -n -d jobs.data -c 32 > jobs.txt
+./zwc encode -n -d jobs.data -c 32 -j 4 | diff -q - jobs.txt
+./zwc decode -t jobs.txt -j 4 | diff -q - jobs.data
+./zwc decode -t jobs.txt -j 0 | diff -q - jobs.data
+
+# range decode
+tail -c +123457 jobs.data | head -c 7890 > range.data
+./zwc decode -t jobs.txt --range 123456:7890 | cmp - range.data
+./zwc encode -n -d jobs.data -e 4 | ./zwc decode --range 123456:7890 | cmp - range.data
+rm range.data
+
+# limits and concatenated files
+if ./zwc decode -t jobs.txt --max-payload-bytes 1000 > /dev/null 2>&1; then
+	echo "test.sh: max-payload-bytes wasn't enforced"
+	exit 1
+fi
+if ./zwc encode -r -n -d jobs.data | ./zwc decode -r --max-payload-bytes 1000 > /dev/null 2>&1; then
+	echo "test.sh: max-payload-bytes wasn't enforced for raw payloads"
+	exit 1
+fi
+if (printf 'message'; cat jobs.txt) | ./zwc decode -f 32,3 --max-scan-bytes 5 > /dev/null 2>&1; then
+	echo "test.sh: max-scan-bytes wasn't enforced for forced encodings"
+	exit 1
+fi
+if ./zwc decode -t jobs.txt --range 0:2000 --max-payload-bytes 1000 > /dev/null 2>&1; then
+	echo "test.sh: max-payload-bytes wasn't enforced for ranges"
+	exit 1
+fi
+
+# auto detection reads the rest of the text, which must be within the scan limit
+sed '1s/\xe2\x80\xac/\xe2\x80\x8d/' jobs.txt > corrupt.txt
+./zwc decode -q -a -t corrupt.txt | cmp - jobs.data
+if ./zwc decode -q -a -t corrupt.txt --max-scan-bytes 1000 > /dev/null 2>&1; then
+	echo "test.sh: max-scan-bytes wasn't enforced for auto detection"
+	exit 1
+fi
+rm corrupt.txt
+
+cat jobs.data jobs.data > cat.data
+cat jobs.txt jobs.txt | ./zwc decode --max-files 2 | diff -q - cat.data
+if cat jobs.txt jobs.txt jobs.txt | ./zwc decode --max-files 2 > /dev/null 2>&1; then
+	echo "test.sh: max-files wasn't enforced"
+	exit 1
+fi
+rm cat.data
+rm jobs.data jobs.txt
+
 rm zwc
 
 echo test.sh: all tests passed
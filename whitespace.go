@@ -0,0 +1,84 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc
+
+import (
+	"bytes"
+)
+
+// WhitespaceBitsPerLine is the number of bits
+// hidden in the trailing whitespace of each line
+const WhitespaceBitsPerLine = 32
+
+// WhitespaceCarrier hides data in trailing spaces and tabs
+// at the end of each line of the message, in the style of SNOW.
+// A space is a 0 bit and a tab is a 1 bit.
+// Any trailing whitespace already in the message is removed.
+var WhitespaceCarrier = NewBitCarrier(whitespace{})
+
+type whitespace struct{}
+
+// Bits returns WhitespaceBitsPerLine for each line of message
+func (whitespace) Bits(message []byte) int {
+	return len(lines(message)) * WhitespaceBitsPerLine
+}
+
+func (whitespace) Embed(message, bits []byte) []byte {
+	var text bytes.Buffer
+	for _, line := range lines(message) {
+		contents, end := lineEnd(line)
+		text.Write(bytes.TrimRight(contents, " \t"))
+
+		n := WhitespaceBitsPerLine
+		if len(bits) < n {
+			n = len(bits)
+		}
+		for _, b := range bits[:n] {
+			if b == 0 {
+				text.WriteByte(' ')
+			} else {
+				text.WriteByte('\t')
+			}
+		}
+		bits = bits[n:]
+
+		text.Write(end)
+	}
+
+	return text.Bytes()
+}
+
+func (whitespace) Extract(text []byte) (bits, message []byte) {
+	var m bytes.Buffer
+	for _, line := range lines(text) {
+		contents, end := lineEnd(line)
+		trimmed := bytes.TrimRight(contents, " \t")
+
+		for _, c := range contents[len(trimmed):] {
+			if c == ' ' {
+				bits = append(bits, 0)
+			} else {
+				bits = append(bits, 1)
+			}
+		}
+
+		m.Write(trimmed)
+		m.Write(end)
+	}
+
+	return bits, m.Bytes()
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2023 Ethan Cheng <ethan@nijika.org>
+//
+// This file is part of ZWC.
+//
+// ZWC is free software: you can redistribute it and/or modify it under the
+// terms of the GNU General Public License as published by the Free Software
+// Foundation, version 3 of the License.
+//
+// ZWC is distributed in the hope that it will be useful, but WITHOUT ANY
+// WARRANTY; without even the implied warranty of MERCHANTABILITY or FITNESS
+// FOR A PARTICULAR PURPOSE. See the GNU General Public License for more
+// details.
+//
+// You should have received a copy of the GNU General Public License along
+// with ZWC. If not, see <https://www.gnu.org/licenses/>.
+
+package zwc_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yadayadajaychan/zwc"
+)
+
+// TestWhitespace tests that data is only hidden in trailing spaces and tabs
+// and the trailing whitespace already in the message is removed
+func TestWhitespace(t *testing.T) {
+	message := []byte("first line  \nsecond line\t\n\nthird line\r\nlast line")
+	restored := []byte("first line\nsecond line\n\nthird line\r\nlast line")
+	data := []byte("hidden")
+
+	text, err := zwc.WhitespaceCarrier.Encode(zwc.NewEncoding(1, 2, 16), message, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range string(text) {
+		if !strings.ContainsRune(string(message)+" \t", r) {
+			t.Errorf("unexpected character %q", r)
+			break
+		}
+	}
+
+	decoded, m, err := zwc.WhitespaceCarrier.Decode(text)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("Expected %q, got %q", data, decoded)
+	}
+	if !bytes.Equal(m, restored) {
+		t.Errorf("Expected %q, got %q", restored, m)
+	}
+
+	// each line holds the same number of bits
+	if got := zwc.WhitespaceCarrier.Capacity(zwc.NewEncoding(1, 2, 16), message[:len("first line  \n")]); got != 0 {
+		t.Error("Expected no capacity in a single line, got", got)
+	}
+}
@@ -18,9 +18,12 @@
 package zwc
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"io"
+	"math/bits"
 	"strconv"
-	"strings"
 	"slices"
 	"unicode/utf8"
 
@@ -30,9 +33,86 @@ import (
 const (
 	V1DelimChar = '\u034F'
 	V1DelimCharUTF8 = "\xcd\x8f"
+
+	// TagDelimChar and TagTerminator are used by 6-bit encoding,
+	// so the whole file is a sequence of tag characters
+	TagDelimChar = '\U000E007E'
+	TagTerminator = '\U000E007F'
+
+	// RadixEncoding is the encodingType of base-N encoding,
+	// which uses every character of the table
+	// so the table doesn't need a power of two characters
+	RadixEncoding = 0
 )
 
 var (
+	// V1Table holds the characters used by version 1 of the ZWC format.
+	// The first 2^encodingType characters are used to encode data.
+	V1Table = [16]string{
+		"\xE2\x80\xAC",     //  0
+		"\xE2\x80\x8C",     //  1
+		"\xE2\x80\x8D",     //  2
+		"\xE2\x81\xA0",     //  3
+		"\xE2\x81\xA1",     //  4
+		"\xE2\x81\xA2",     //  5
+		"\xE2\x81\xA3",     //  6
+		"\xE2\x81\xA4",     //  7
+		"\xE2\x81\xAA",     //  8
+		"\xE2\x81\xAB",     //  9
+		"\xE2\x81\xAC",     // 10
+		"\xE2\x81\xAD",     // 11
+		"\xE2\x81\xAE",     // 12
+		"\xE2\x81\xAF",     // 13
+		"\xF0\x9D\x85\xB3", // 14
+		"\xF0\x9D\x85\xB4", // 15
+	}
+
+	// ExtendedTable holds the characters used by 5-bit encoding.
+	// The first 16 characters are the same as V1Table.
+	ExtendedTable = [32]string{
+		"\xE2\x80\xAC",     //  0
+		"\xE2\x80\x8C",     //  1
+		"\xE2\x80\x8D",     //  2
+		"\xE2\x81\xA0",     //  3
+		"\xE2\x81\xA1",     //  4
+		"\xE2\x81\xA2",     //  5
+		"\xE2\x81\xA3",     //  6
+		"\xE2\x81\xA4",     //  7
+		"\xE2\x81\xAA",     //  8
+		"\xE2\x81\xAB",     //  9
+		"\xE2\x81\xAC",     // 10
+		"\xE2\x81\xAD",     // 11
+		"\xE2\x81\xAE",     // 12
+		"\xE2\x81\xAF",     // 13
+		"\xF0\x9D\x85\xB3", // 14
+		"\xF0\x9D\x85\xB4", // 15
+		"\xF0\x9D\x85\xB5", // 16 U+1D175
+		"\xF0\x9D\x85\xB6", // 17 U+1D176
+		"\xF0\x9D\x85\xB7", // 18 U+1D177
+		"\xF0\x9D\x85\xB8", // 19 U+1D178
+		"\xF0\x9D\x85\xB9", // 20 U+1D179
+		"\xF0\x9D\x85\xBA", // 21 U+1D17A
+		"\xE2\x80\x8E",     // 22 U+200E
+		"\xE2\x80\xAA",     // 23 U+202A
+		"\xEF\xB8\x80",     // 24 U+FE00
+		"\xEF\xB8\x81",     // 25 U+FE01
+		"\xEF\xB8\x82",     // 26 U+FE02
+		"\xEF\xB8\x83",     // 27 U+FE03
+		"\xEF\xB8\x84",     // 28 U+FE04
+		"\xEF\xB8\x85",     // 29 U+FE05
+		"\xEF\xB8\x86",     // 30 U+FE06
+		"\xEF\xB8\x87",     // 31 U+FE07
+	}
+
+	// VariationSelectorTable holds the characters used by 8-bit encoding.
+	// Data 0 to 15 are U+FE00 to U+FE0F and
+	// data 16 to 255 are U+E0100 to U+E01EF.
+	VariationSelectorTable = variationSelectors()
+
+	// TagTable holds the characters used by 6-bit encoding,
+	// which are the tag characters U+E0020 to U+E005F.
+	TagTable = tags()
+
 	CRC8 = &crc.Parameters{
 		Width: 8,
 		Polynomial: 0x07,
@@ -59,143 +139,451 @@ var (
                 ReflectOut: true,
                 FinalXor: 0xFFFFFFFF,
 	}
+
+	// lookup tables for the checksums, which are
+	// only generated once instead of for every checksum
+	crc8Table  = crc.NewTable(CRC8)
+	crc16Table = crc.NewTable(CRC16)
+	crc32Table = crc.NewTable(CRC32)
 )
 
+// variationSelectors returns the 256 variation selectors in order
+func variationSelectors() (table [256]string) {
+	for i := range table {
+		if i < 16 {
+			table[i] = string(rune(0xFE00 + i))
+		} else {
+			table[i] = string(rune(0xE0100 + i - 16))
+		}
+	}
+	return table
+}
+
+// tags returns the first 64 printable tag characters in order
+func tags() (table [64]string) {
+	for i := range table {
+		table[i] = string(rune(0xE0020 + i))
+	}
+	return table
+}
+
+// An Encoding holds the settings of a ZWC file.
+// It is never changed after it is created,
+// so it can be shared by several goroutines.
+// The checksum of the data is calculated by the Encoder and Decoder streams.
 type Encoding struct {
-	encode       [16]string
+	encode       []string
 	delimChar    rune
 	version      int
 	encodingType int
 	checksumType int
-	encodeMap    [256]string
-	decodeMap    map[rune]byte
-	checksum     *crc.Hash
-	crc          uint64
+	encodeMap    [256]string // unused by 5-bit, 6-bit, and base-N encoding
+	radixChars   [9]int      // characters needed for 0 to 8 bytes of base-N encoding
+	decodeMap    decodeTable
+	minCharLen   int // length in bytes of the shortest character used
+	maxCharLen   int // length in bytes of the longest character used
+	profile      int // profile recorded in version 2 headers
 }
 
+// NewEncoding is like NewEncodingE but panics if the settings are invalid
 func NewEncoding(version, encodingType, checksumType int) *Encoding {
-	switch version {
-	case 1:
-		table := [16]string{
-			"\xE2\x80\xAC",     //  0
-			"\xE2\x80\x8C",     //  1
-			"\xE2\x80\x8D",     //  2
-			"\xE2\x81\xA0",     //  3
-			"\xE2\x81\xA1",     //  4
-			"\xE2\x81\xA2",     //  5
-			"\xE2\x81\xA3",     //  6
-			"\xE2\x81\xA4",     //  7
-			"\xE2\x81\xAA",     //  8
-			"\xE2\x81\xAB",     //  9
-			"\xE2\x81\xAC",     // 10
-			"\xE2\x81\xAD",     // 11
-			"\xE2\x81\xAE",     // 12
-			"\xE2\x81\xAF",     // 13
-			"\xF0\x9D\x85\xB3", // 14
-			"\xF0\x9D\x85\xB4", // 15
-		}
-
-		return NewCustomEncoding(table, V1DelimChar, version, encodingType, checksumType)
-	default:
-		panic("only ZWC file format version 1 is supported")
+	enc, err := NewEncodingE(version, encodingType, checksumType)
+	if err != nil {
+		panic(err)
+	}
+	return enc
+}
+
+// NewEncodingE returns an Encoding using the characters in the specification,
+// or an InvalidEncodingError if the settings are invalid.
+// 6-bit and 8-bit encoding use the tags and variation-selectors profiles,
+// so like 5-bit and base-N encoding they require version 2.
+func NewEncodingE(version, encodingType, checksumType int) (*Encoding, error) {
+	if err := ValidEncoding(version, encodingType, checksumType); err != nil {
+		return nil, err
 	}
+
+	// 6-bit and 8-bit encoding have their own tables
+	if id, ok := encodingProfile(encodingType); ok {
+		return newProfileEncodingE(id, encodingType, checksumType)
+	}
+	return NewCustomTableEncodingE(ExtendedTable[:], V1DelimChar, version, encodingType, checksumType)
 }
 
 type InvalidEncodingError struct {
-	msg                 string
+	encodingType        int   // for VersionMismatch and UnsupportedTable
+	alphabetErr         error // for InvalidAlphabet, returned by Unwrap
 	InvalidVersion      bool
 	InvalidEncodingType bool
 	InvalidChecksumType bool
+	InvalidProfile      bool
+	VersionMismatch     bool // encodingType 0, 5, 6, and 8 require version 2
+	UnsupportedTable    bool // table has too few or too many characters for encodingType
+	InvalidAlphabet     bool // table or delimChar is invalid
 }
 
-func (e InvalidEncodingError) Error() string{
-	e.msg = "invalid encoding: "
+func (e InvalidEncodingError) Error() string {
+	msg := "invalid encoding: "
 
 	switch {
-	case e.InvalidVersion:
-		e.msg += "only ZWC file format version 1 is supported"
-	case e.InvalidEncodingType:
-		e.msg += "encodingType must be either 2, 3, or 4"
-	case e.InvalidChecksumType:
-		e.msg += "checksumType must be either 0, 8, 16, or 32"
+	case e.VersionMismatch:
+		msg += "encodingType " + strconv.Itoa(e.encodingType) + " requires version 2"
+	case e.UnsupportedTable:
+		msg += "table has an unsupported length for encodingType " + strconv.Itoa(e.encodingType)
+	case e.InvalidAlphabet && e.alphabetErr != nil:
+		msg += e.alphabetErr.Error()
+	case e.kind() != nil:
+		msg += e.kind().Error()
 	}
 
-	return e.msg
+	return msg
 }
 
 func ValidEncoding(version, encodingType, checksumType int) (err error) {
 	switch {
-	case version != 1:
+	case version != 1 && version != 2:
 		err = InvalidEncodingError{InvalidVersion: true}
-	case !(2 <= encodingType && encodingType <= 4):
+	case !(2 <= encodingType && encodingType <= 6 || encodingType == 8 ||
+	       encodingType == RadixEncoding):
 		err = InvalidEncodingError{InvalidEncodingType: true}
-	case !(0 <= checksumType && checksumType <= 32 && checksumType%8 == 0):
+	case (encodingType >= 5 || encodingType == RadixEncoding) && version == 1:
+		err = InvalidEncodingError{VersionMismatch: true, encodingType: encodingType}
+	case !(checksumType == 0 || checksumType == 8 || checksumType == 16 || checksumType == 32):
 		err = InvalidEncodingError{InvalidChecksumType: true}
 	}
 
 	return err
 }
 
-func NewCustomEncoding(table [16]string, delimChar rune, version, encodingType, checksumType int) *Encoding {
-	// sanity checks
-	if err := ValidEncoding(version, encodingType, checksumType); err != nil {
-		panic(err)
+type InvalidAlphabetError struct {
+	Index        int  // index in table of the invalid character
+	InvalidDelim bool // delimChar is not a valid rune
+	InvalidChar  bool // not a single valid utf-8 character
+	Missing      bool // empty string where a character is required
+	Duplicate    bool // same as a character earlier in table
+	DelimOverlap bool // same as delimChar
+}
+
+func (e InvalidAlphabetError) Error() string {
+	msg := "invalid alphabet: "
+
+	switch {
+	case e.InvalidDelim:
+		msg += "delimChar is illegal rune"
+	case e.InvalidChar:
+		msg += "invalid character in table at index " + strconv.Itoa(e.Index)
+	case e.Missing:
+		msg += "missing character in table at index " + strconv.Itoa(e.Index)
+	case e.Duplicate:
+		msg += "duplicate character in table at index " + strconv.Itoa(e.Index)
+	case e.DelimOverlap:
+		msg += "character in table at index " + strconv.Itoa(e.Index) +
+				" is the same as delimChar"
 	}
+
+	return msg
+}
+
+// ValidAlphabet checks that table and delimChar can be used
+// to encode data with NewCustomTableEncoding.
+// Each character in table must be a single valid rune
+// which is different from the other characters and delimChar.
+// The first 4 characters are required because they encode the header.
+// After that, table may end early by using empty strings.
+// All problems found are returned, joined with errors.Join.
+func ValidAlphabet(table []string, delimChar rune) error {
+	var errs []error
+
 	if !utf8.ValidRune(delimChar) {
-		panic("delimChar is illegal rune")
+		errs = append(errs, InvalidAlphabetError{InvalidDelim: true})
 	}
+
+	seen := make(map[string]bool, len(table))
+	end := false // whether the end of table has been reached
 	for i, v := range table {
-		if !utf8.ValidString(v) {
-			panic("invalid string in table at index " + strconv.Itoa(i))
+		if v == "" {
+			if i < 4 {
+				errs = append(errs, InvalidAlphabetError{Index: i, Missing: true})
+			}
+			end = true
+			continue
+		} else if end {
+			errs = append(errs, InvalidAlphabetError{Index: i - 1, Missing: true})
+			end = false
+		}
+
+		char, size := utf8.DecodeRuneInString(v)
+		switch {
+		case char == utf8.RuneError || size != len(v):
+			errs = append(errs, InvalidAlphabetError{Index: i, InvalidChar: true})
+		case seen[v]:
+			errs = append(errs, InvalidAlphabetError{Index: i, Duplicate: true})
+		case char == delimChar:
+			errs = append(errs, InvalidAlphabetError{Index: i, DelimOverlap: true})
 		}
+		seen[v] = true
+	}
+	for i := len(table); i < 4; i++ {
+		errs = append(errs, InvalidAlphabetError{Index: i, Missing: true})
+	}
+
+	return errors.Join(errs...)
+}
+
+func NewCustomEncoding(table [16]string, delimChar rune, version, encodingType, checksumType int) *Encoding {
+	return NewCustomTableEncoding(table[:], delimChar, version, encodingType, checksumType)
+}
+
+// NewCustomEncodingE is like NewCustomEncoding
+// but returns an error instead of panicking
+func NewCustomEncodingE(table [16]string, delimChar rune, version, encodingType, checksumType int) (*Encoding, error) {
+	return NewCustomTableEncodingE(table[:], delimChar, version, encodingType, checksumType)
+}
+
+// NewCustomTableEncoding is like NewCustomEncoding
+// but table may have up to 256 characters,
+// which allows 5-bit, 6-bit, and 8-bit encoding.
+// If encodingType is RadixEncoding, every character in table is used
+// and data is encoded in base len(table).
+func NewCustomTableEncoding(table []string, delimChar rune, version, encodingType, checksumType int) *Encoding {
+	enc, err := NewCustomTableEncodingE(table, delimChar, version, encodingType, checksumType)
+	if err != nil {
+		panic(err)
+	}
+	return enc
+}
+
+// NewCustomTableEncodingE is like NewCustomTableEncoding
+// but returns an error instead of panicking.
+// The error is an InvalidEncodingError if the settings are invalid,
+// table has too few characters for encodingType or more than 256 for RadixEncoding,
+// or table or delimChar are invalid.
+// If table or delimChar are invalid, the InvalidAlphabetError values
+// from ValidAlphabet can be found with errors.As.
+func NewCustomTableEncodingE(table []string, delimChar rune, version, encodingType, checksumType int) (*Encoding, error) {
+	// sanity checks
+	if err := ValidEncoding(version, encodingType, checksumType); err != nil {
+		return nil, err
+	}
+	if err := ValidAlphabet(table, delimChar); err != nil {
+		return nil, InvalidEncodingError{InvalidAlphabet: true, alphabetErr: err}
+	}
+	if !tableSupports(table, encodingType) {
+		return nil, InvalidEncodingError{UnsupportedTable: true, encodingType: encodingType}
+	}
+
+	// number of characters used to encode data
+	size := 1 << encodingType
+	if encodingType == RadixEncoding {
+		size = tableLen(table)
 	}
 
 	//generate lookup table for encoding
 	var encodeMap [256]string
 
-	for i := range encodeMap {
-		var output string
-
-		for j := 0; j < 8; j += encodingType {
-			output = table[(i>>j)&(1<<encodingType-1)] + output
+	// 5-bit, 6-bit, and base-N encoding don't encode whole bytes
+	// so they use the table directly
+	if !packed(encodingType) && encodingType != RadixEncoding {
+		// every output is a substring of one string
+		// so the table only needs one allocation
+		var outputs []byte
+		var ends [256]int
+		for i := range encodeMap {
+			for j := 7 / encodingType * encodingType; j >= 0; j -= encodingType {
+				outputs = append(outputs, table[(i>>j)&(1<<encodingType-1)]...)
+			}
+			ends[i] = len(outputs)
 		}
 
-		encodeMap[i] = output
+		all := string(outputs)
+		start := 0
+		for i := range encodeMap {
+			encodeMap[i] = all[start:ends[i]]
+			start = ends[i]
+		}
 	}
 
 	// generate map for decoding
-	decodeMap := make(map[rune]byte, 16)
-	for i := 0; i < 1<<encodingType; i++ {
-		char, _ := utf8.DecodeRuneInString(table[i])
-		if char == utf8.RuneError {
-			panic("Invalid utf8 in encode table")
+	// generate the number of characters
+	// needed for each length of a base-N chunk
+	var radixChars [9]int
+	for k := 1; encodingType == RadixEncoding && k <= 8; k++ {
+		// count the digits of the largest k byte number
+		for v := uint64(1)<<(8*k) - 1; v > 0; v /= uint64(size) {
+			radixChars[k]++
 		}
-		decodeMap[char] = byte(i)
 	}
 
-	var checksum *crc.Hash
-	switch checksumType {
-	case 0:
-		checksum = nil
-	case 8:
-		checksum = crc.NewHash(CRC8)
-	case 16:
-		checksum = crc.NewHash(CRC16)
-	case 32:
-		checksum = crc.NewHash(CRC32)
+	decodeMap := newDecodeTable(table[:size])
+	minCharLen, maxCharLen := utf8.UTFMax, 0
+	for i := 0; i < size; i++ {
+		if len(table[i]) < minCharLen {
+			minCharLen = len(table[i])
+		}
+		if len(table[i]) > maxCharLen {
+			maxCharLen = len(table[i])
+		}
 	}
 
 	return &Encoding{
-		table,
+		table[:size],
 		delimChar,
 		version,
 		encodingType,
 		checksumType,
 		encodeMap,
+		radixChars,
 		decodeMap,
-		checksum,
-		0,
+		minCharLen,
+		maxCharLen,
+		ProfileDefault,
+	}, nil
+}
+
+// A decodeTable maps the characters of a table to their values.
+// The characters are grouped into pages of 256 characters,
+// so finding a character is a binary search of the few pages
+// used by the table and an array lookup.
+type decodeTable []decodePage
+
+type decodePage struct {
+	hi     rune        // the bits of the characters above the lowest 8
+	values [256]uint16 // value + 1 of each character, or 0 if it isn't in the table
+}
+
+// newDecodeTable returns a decodeTable for the characters of table
+func newDecodeTable(table []string) decodeTable {
+	var t decodeTable
+	for i, v := range table {
+		r, _ := utf8.DecodeRuneInString(v)
+		j := t.page(r >> 8)
+		if j == len(t) || t[j].hi != r>>8 {
+			t = slices.Insert(t, j, decodePage{hi: r >> 8})
+		}
+		t[j].values[r&0xff] = uint16(i) + 1
+	}
+	return t
+}
+
+// page returns the index of the page for hi,
+// or where it would be inserted if there is none
+func (t decodeTable) page(hi rune) int {
+	lo, high := 0, len(t)
+	for lo < high {
+		mid := int(uint(lo+high) >> 1)
+		if t[mid].hi < hi {
+			lo = mid + 1
+		} else {
+			high = mid
+		}
 	}
+	return lo
+}
+
+// lookup returns the value of r and whether r is in the table
+func (t decodeTable) lookup(r rune) (byte, bool) {
+	var page int
+	return t.lookupPage(r, &page)
+}
+
+// lookupPage is like lookup but *page is the index of the page
+// which is tried first and is set to the page of r,
+// since consecutive characters are usually in the same page
+func (t decodeTable) lookupPage(r rune, page *int) (byte, bool) {
+	j := *page
+	if j >= len(t) || t[j].hi != r>>8 {
+		j = t.page(r >> 8)
+		if j == len(t) || t[j].hi != r>>8 {
+			return 0, false
+		}
+		*page = j
+	}
+
+	if v := t[j].values[r&0xff]; v != 0 {
+		return byte(v - 1), true
+	}
+	return 0, false
+}
+
+// nextChar decodes the first character of src and
+// returns its value, its length in bytes, and whether it is in the table.
+// page is passed to lookupPage.
+func (enc *Encoding) nextChar(src []byte, page *int) (v byte, size int, ok bool) {
+	var r rune
+	c := src[0]
+	switch {
+	case c < utf8.RuneSelf:
+		r, size = rune(c), 1
+	// most characters used by the tables take 3 bytes,
+	// which are decoded here instead of by utf8.DecodeRune
+	case c&0xF0 == 0xE0 && len(src) >= 3 && src[1]&0xC0 == 0x80 && src[2]&0xC0 == 0x80:
+		r, size = rune(c&0x0F)<<12|rune(src[1]&0x3F)<<6|rune(src[2]&0x3F), 3
+		if r < 0x800 || 0xD800 <= r && r < 0xE000 { // overlong or surrogate
+			r, size = utf8.RuneError, 1
+		}
+	default:
+		r, size = utf8.DecodeRune(src)
+	}
+	v, ok = enc.decodeMap.lookupPage(r, page)
+	return v, size, ok
+}
+
+// invalidUTF8 reports whether the first size bytes of src,
+// which nextChar didn't find in the table, are invalid UTF-8.
+// Every valid character other than ASCII is at least 2 bytes long.
+func invalidUTF8(src []byte, size int) bool {
+	return size == 1 && src[0] >= utf8.RuneSelf
+}
+
+// crcTable returns the lookup table for the checksum type of enc,
+// or nil if there is no checksum
+func (enc *Encoding) crcTable() *crc.Table {
+	switch enc.checksumType {
+	case 8:
+		return crc8Table
+	case 16:
+		return crc16Table
+	case 32:
+		return crc32Table
+	}
+	return nil
+}
+
+// CRC returns the checksum of data
+// using the checksum type of enc
+func (enc *Encoding) CRC(data []byte) uint64 {
+	if t := enc.crcTable(); t != nil {
+		return t.CalculateCRC(data)
+	}
+	return 0
+}
+
+// tableSupports reports whether table has enough characters for encodingType
+// and, for base-N encoding, no more than 256
+func tableSupports(table []string, encodingType int) bool {
+	if encodingType == RadixEncoding {
+		// digits of base-N encoding must fit in a byte
+		n := tableLen(table)
+		return n >= 4 && n <= 256
+	}
+	return len(table) >= 1<<encodingType && table[1<<encodingType-1] != ""
+}
+
+// tableLen returns the number of characters in table
+// before the first empty string
+func tableLen(table []string) int {
+	for i, v := range table {
+		if v == "" {
+			return i
+		}
+	}
+	return len(table)
+}
+
+// packed reports whether encodingType treats data as a stream of bits
+// instead of encoding each byte separately
+func packed(encodingType int) bool {
+	return encodingType == 5 || encodingType == 6
 }
 
 func (enc *Encoding) Version() int {
@@ -210,6 +598,12 @@ func (enc *Encoding) ChecksumType() int {
 	return enc.checksumType
 }
 
+// Profile returns the name of the profile used by enc.
+// Encodings created with NewCustomEncoding use the default profile.
+func (enc *Encoding) Profile() string {
+	return profiles[enc.profile].name
+}
+
 func (enc *Encoding) Encode(dst, src []byte) int {
 	di := 0
 	di += utf8.EncodeRune(dst[di:], enc.delimChar)
@@ -218,18 +612,57 @@ func (enc *Encoding) Encode(dst, src []byte) int {
 
 	di += enc.EncodePayload(dst[di:], src)
 	di += utf8.EncodeRune(dst[di:], enc.delimChar)
-	di += enc.EncodeChecksum(dst[di:])
+	di += enc.EncodeChecksum(dst[di:], enc.CRC(src))
+	if t := profiles[enc.profile].terminator; t != 0 {
+		di += utf8.EncodeRune(dst[di:], t)
+	}
 	return di
 }
 
-func (enc *Encoding) EncodeHeader(dst []byte) int {
-	di := 0
+// AppendEncode appends the ZWC file of src to dst
+// and returns the extended buffer
+func (enc *Encoding) AppendEncode(dst, src []byte) []byte {
+	dst = slices.Grow(dst, enc.EncodedMaxLen(len(src)))
+	n := enc.Encode(dst[len(dst):cap(dst)], src)
+	return dst[:len(dst)+n]
+}
 
-	// v1 corresponds to a value of 0
-	di += copy(dst[di:], enc.encode[0])
+// EncodeToString returns the ZWC file of src
+func (enc *Encoding) EncodeToString(src []byte) string {
+	buf := make([]byte, enc.EncodedMaxLen(len(src)))
+	return string(buf[:enc.Encode(buf, src)])
+}
 
-	di += copy(dst[di:], enc.encode[enc.encodingType-2])
+// EncodedLen returns the length in bytes of
+// the ZWC file which Encode writes for n bytes of data.
+// The length only depends on n if every character in the table
+// has the same length, and then it is the same as EncodedMaxLen.
+// Otherwise, such as for 4-bit encoding, EncodedLen returns -1
+// and EncodedMaxLen must be used instead.
+func (enc *Encoding) EncodedLen(n int) int {
+	if enc.minCharLen != enc.maxCharLen {
+		return -1
+	}
+	return enc.EncodedMaxLen(n)
+}
 
+// DecodedLen returns the length in bytes of the data
+// in a ZWC file of n bytes written by Encode.
+// Like EncodedLen, it returns -1 if the characters in the table
+// have different lengths, since the length then depends on the file.
+func (enc *Encoding) DecodedLen(n int) int {
+	if enc.minCharLen != enc.maxCharLen {
+		return -1
+	}
+
+	n -= enc.EncodedMaxLen(0) // everything except the payload
+	if n < 0 {
+		return 0
+	}
+	return enc.decodedBytes(n / enc.minCharLen)
+}
+
+func (enc *Encoding) EncodeHeader(dst []byte) int {
 	var checksumType int
 	switch enc.checksumType {
 	case 0, 8, 16:
@@ -237,53 +670,306 @@ func (enc *Encoding) EncodeHeader(dst []byte) int {
 	case 32:
 		checksumType = 3
 	}
-	di += copy(dst[di:], enc.encode[checksumType])
 
-	crc := CRC2(byte(0<<6 + (enc.encodingType-2)<<4 + checksumType<<2))
-	di += copy(dst[di:], enc.encode[crc])
+	// v1 corresponds to a value of 0
+	header := []byte{byte((enc.version-1)<<6 + enc.encodingID()&3<<4 + checksumType<<2)}
+
+	// version 2 adds a second byte containing the profile
+	// and the high bits of the encoding
+	if enc.version == 2 {
+		header = append(header, byte(enc.profile<<4 + enc.encodingID()>>2<<2))
+	}
+
+	di := 0
+	for _, b := range header {
+		b += CRC2(b)
+		for shift := 6; shift >= 0; shift -= 2 {
+			di += copy(dst[di:], enc.encode[b>>shift & 3])
+		}
+	}
 
 	return di
 }
 
-func (enc *Encoding) EncodePayload(dst, src []byte) int {
-	n := len(src)
+// encodingID returns the value of the encoding field of the header.
+// Values above 3 only fit in a version 2 header.
+func (enc *Encoding) encodingID() int {
+	switch {
+	// 4-bit encoding using the bmp-only profile
+	// has its own value so it can use a version 1 header
+	case enc.profile == ProfileBMPOnly && enc.encodingType == 4:
+		return 3
+	case enc.encodingType == 5:
+		return 4
+	case enc.encodingType == 8:
+		return 5
+	case enc.encodingType == 6:
+		return 6
+	case enc.encodingType == RadixEncoding:
+		return 7
+	}
 
-	if n == 0 {
+	return enc.encodingType - 2
+}
+
+// EncodePayload encodes src into dst
+// and returns the number of bytes written to dst.
+// The checksum of src can be found with CRC.
+func (enc *Encoding) EncodePayload(dst, src []byte) int {
+	if len(src) == 0 {
 		return 0
 	}
 
-	if enc.checksumType != 0 {
-		enc.checksum.Update(src)
+	return enc.encodeRaw(dst, src)
+}
+
+// encodeRaw encodes src into dst.
+// It returns the number of bytes written to dst.
+func (enc *Encoding) encodeRaw(dst, src []byte) int {
+	if packed(enc.encodingType) {
+		return enc.encodePacked(dst, src)
+	} else if enc.encodingType == RadixEncoding {
+		return enc.encodeRadix(dst, src)
 	}
 
-	si, di := 0, 0
-	for si < n {
-		di += copy(dst[di:], enc.encodeMap[src[si]])
-		si += 1
+	di := 0
+	for _, b := range src {
+		di += copy(dst[di:], enc.encodeMap[b])
 	}
 
 	return di
 }
 
-func (enc *Encoding) EncodeChecksum(dst []byte) int {
-	if enc.checksumType == 0 {
-		return 0
+// encodePacked encodes src into dst encodingType bits at a time,
+// so every group of groupLen bytes of src is encoded
+// as a whole number of characters.
+// If len(src) isn't a multiple of groupLen,
+// the last character is padded with zero bits.
+func (enc *Encoding) encodePacked(dst, src []byte) int {
+	di := 0
+	e := enc.encodingType
+	var bits uint16 // bits which haven't been encoded yet
+	var nBits int
+
+	for _, b := range src {
+		bits = bits<<8 | uint16(b)
+		nBits += 8
+
+		for nBits >= e {
+			nBits -= e
+			di += copy(dst[di:], enc.encode[bits>>nBits & (1<<e-1)])
+		}
+		bits &= 1<<nBits - 1
+	}
+
+	if nBits > 0 {
+		di += copy(dst[di:], enc.encode[bits<<(e-nBits) & (1<<e-1)])
 	}
 
-	enc.crc = enc.checksum.CRC()
-	enc.checksum.Reset()
+	return di
+}
 
+// encodeRadix encodes src into dst in chunks of 8 bytes.
+// Each chunk is treated as a big-endian number and
+// written in base len(enc.encode), most significant digit first,
+// using the number of characters needed for the largest 8 byte number.
+// The last chunk may be shorter and uses fewer characters.
+func (enc *Encoding) encodeRadix(dst, src []byte) int {
 	di := 0
-	for shift := enc.checksumType-8; shift >= 0; shift -= 8 {
-		di += copy(dst[di:], enc.encodeMap[enc.crc>>shift & 255])
+	radix := uint64(len(enc.encode))
+	var digits [64]byte
+
+	for len(src) > 0 {
+		k := 8
+		if len(src) < k {
+			k = len(src)
+		}
+
+		var v uint64
+		for _, b := range src[:k] {
+			v = v<<8 | uint64(b)
+		}
+
+		chars := enc.radixChars[k]
+		for i := chars - 1; i >= 0; i-- {
+			digits[i] = byte(v % radix)
+			v /= radix
+		}
+		for _, d := range digits[:chars] {
+			di += copy(dst[di:], enc.encode[d])
+		}
+
+		src = src[k:]
 	}
+
 	return di
 }
 
+// groupLen returns the number of bytes which
+// are encoded as a whole number of characters.
+// 5-bit encoding encodes 5 bytes as 8 characters,
+// 6-bit encoding encodes 3 bytes as 4 characters, and
+// base-N encoding encodes chunks of 8 bytes.
+func (enc *Encoding) groupLen() int {
+	switch enc.encodingType {
+	case 5:
+		return 5
+	case 6:
+		return 3
+	case RadixEncoding:
+		return 8
+	}
+
+	return 1
+}
+
+// chunkLen is the number of bytes encoded at a time by streams,
+// which is a multiple of every groupLen
+const chunkLen = 256 * 120
+
+// A payloadWriter encodes a payload to w chunkLen bytes at a time.
+// The buffer for the encoded chunk is reused by every write.
+type payloadWriter struct {
+	enc      *Encoding
+	w        io.Writer
+	pending  [8]byte // bytes which don't fill a group of 5-bit, 6-bit, or base-N encoding
+	nPending int
+	buf      []byte   // encoded output
+	bufs     [][]byte // encoded output of each goroutine of writePayloadParallel
+}
+
+// buffer returns a buffer of n bytes, which is only valid until the next call
+func (pw *payloadWriter) buffer(n int) []byte {
+	if cap(pw.buf) < n {
+		pw.buf = make([]byte, n)
+	}
+	return pw.buf[:n]
+}
+
+// writePayload encodes the whole groups of the pending bytes and p to w
+// and keeps the bytes left over, which must be kept until the end of the payload.
+func (pw *payloadWriter) writePayload(p []byte) error {
+	groupLen := pw.enc.groupLen()
+
+	// complete the pending group
+	if pw.nPending > 0 {
+		k := copy(pw.pending[pw.nPending:groupLen], p)
+		pw.nPending += k
+		p = p[k:]
+		if pw.nPending < groupLen {
+			return nil
+		}
+		pw.nPending = 0
+		if err := pw.encodeChunk(pw.pending[:groupLen]); err != nil {
+			return err
+		}
+	}
+
+	whole := len(p) - len(p)%groupLen
+	for src := p[:whole]; len(src) > 0; {
+		k := chunkLen
+		if len(src) < k {
+			k = len(src)
+		}
+		if err := pw.encodeChunk(src[:k]); err != nil {
+			return err
+		}
+		src = src[k:]
+	}
+
+	pw.nPending = copy(pw.pending[:], p[whole:])
+	return nil
+}
+
+// closePayload encodes the pending bytes, which are the end of the payload
+func (pw *payloadWriter) closePayload() error {
+	if pw.nPending == 0 {
+		return nil
+	}
+	n := pw.nPending
+	pw.nPending = 0
+	return pw.encodeChunk(pw.pending[:n])
+}
+
+func (pw *payloadWriter) encodeChunk(src []byte) error {
+	dst := pw.buffer(pw.enc.EncodedPayloadMaxLen(len(src)))
+	size := pw.enc.encodeRaw(dst, src)
+	_, err := pw.w.Write(dst[:size])
+	return err
+}
+
+// readFrom writes the data read from r to w until EOF
+// using buf and returns the number of bytes read.
+// If full is true, buf is filled before it is written.
+func readFrom(w io.Writer, r io.Reader, buf []byte, full bool) (n int64, err error) {
+	for {
+		k, err := r.Read(buf)
+		if full && err == nil {
+			// fill the rest of buf
+			var kk int
+			kk, err = io.ReadFull(r, buf[k:])
+			k += kk
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+		}
+		if k > 0 {
+			n += int64(k)
+			if _, err := w.Write(buf[:k]); err != nil {
+				return n, err
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+// writeTo reads from r until EOF using buf,
+// writes the data to w, and returns the number of bytes written
+func writeTo(w io.Writer, r io.Reader, buf []byte) (n int64, err error) {
+	for {
+		k, err := r.Read(buf)
+		if k > 0 {
+			k, err := w.Write(buf[:k])
+			n += int64(k)
+			if err != nil {
+				return n, err
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+	}
+}
+
+// EncodeChecksum encodes the checksum crc into dst
+// and returns the number of bytes written to dst
+func (enc *Encoding) EncodeChecksum(dst []byte, crc uint64) int {
+	if enc.checksumType == 0 {
+		return 0
+	}
+
+	// convert crc to big-endian bytes
+	var buf [4]byte
+	checksum := buf[:enc.checksumType/8]
+	for i := range checksum {
+		checksum[i] = byte(crc >> ((len(checksum)-1-i) * 8))
+	}
+	return enc.encodeRaw(dst, checksum)
+}
+
 // EncodedLen returns the maximum length in bytes of
 // the encoded ZWC file
 func (enc *Encoding) EncodedMaxLen(n int) int {
-	const delimLen = 6 // there are 3 delim chars and each are 2 bytes long
+	delimLen := 3 * utf8.RuneLen(enc.delimChar) // there are 3 delim chars
+	if t := profiles[enc.profile].terminator; t != 0 {
+		delimLen += utf8.RuneLen(t)
+	}
 	return delimLen + enc.EncodedHeaderLen() + enc.EncodedPayloadMaxLen(n) +
 		enc.EncodedChecksumMaxLen()
 }
@@ -291,46 +977,74 @@ func (enc *Encoding) EncodedMaxLen(n int) int {
 // EncodedPayloadLen returns the maximum length in bytes of
 // the encoded ZWC payload
 func (enc *Encoding) EncodedPayloadMaxLen(n int) int {
-	switch enc.encodingType {
-	case 2:
-		// each byte takes 4 characters to encode
-		// each character is 3 bytes long
-		return n * 12
-	case 3:
-		// each byte take 3 characters to encode
-		// each character is 3 bytes long
-		return n * 9
-	case 4:
-		// each byte takes 2 characters to encode
-		// each character can be up to 4 bytes long
-		return n * 8
-	}
-
-	return 0
+	return enc.encodedChars(n) * enc.maxCharLen
 }
 
 // EncodedHeaderLen returns the length in bytes of
 // the encoded ZWC header
 func (enc *Encoding) EncodedHeaderLen() int {
-	return 12 // header always uses 2-bit encoding
+	// header always uses 2-bit encoding
+	var maxLen int
+	for _, v := range enc.encode[:4] {
+		if len(v) > maxLen {
+			maxLen = len(v)
+		}
+	}
+	return 4 * enc.version * maxLen // version 2 headers are twice as long
 }
 
 // EncodedChecksumLen returns the maximum length in bytes of
 // the encoded ZWC checksum
 func (enc *Encoding) EncodedChecksumMaxLen() int {
+	return enc.EncodedPayloadMaxLen(enc.checksumType / 8)
+}
+
+// encodedChars returns the number of characters
+// needed to encode n bytes
+func (enc *Encoding) encodedChars(n int) int {
+	switch enc.encodingType {
+	case 2:
+		return 4 * n
+	case 3:
+		return 3 * n
+	case 4:
+		return 2 * n
+	case 5:
+		return (8*n + 4) / 5
+	case 6:
+		return (4*n + 2) / 3
+	case 8:
+		return n
+	case RadixEncoding:
+		return n/8*enc.radixChars[8] + enc.radixChars[n%8]
+	}
+
+	return 0
+}
+
+// decodedBytes returns the maximum number of bytes
+// which n characters can decode to
+func (enc *Encoding) decodedBytes(n int) int {
 	switch enc.encodingType {
 	case 2:
-		// each byte takes 4 characters to encode
-		// each character is 3 bytes long
-		return enc.checksumType / 8 * 12
+		return n / 4
 	case 3:
-		// each byte take 3 characters to encode
-		// each character is 3 bytes long
-		return enc.checksumType / 8 * 9
+		return n / 3
 	case 4:
-		// each byte takes 2 characters to encode
-		// each character can be up to 4 bytes long
-		return enc.checksumType / 8 * 8
+		return n / 2
+	case 5:
+		return 5 * n / 8
+	case 6:
+		return 3 * n / 4
+	case 8:
+		return n
+	case RadixEncoding:
+		// find the longest chunk which fits in the characters left over
+		k := 0
+		for k < 8 && enc.radixChars[k+1] <= n%enc.radixChars[8] {
+			k++
+		}
+		return n/enc.radixChars[8]*8 + k
 	}
 
 	return 0
@@ -345,59 +1059,93 @@ func (enc *Encoding) DelimCharAsUTF8() []byte {
 }
 
 
-type encoder struct {
-	enc    *Encoding
-	w      io.Writer
-	header bool // whether or not the header has been written yet
+// An Encoder writes a ZWC file to a stream
+// and calculates the checksum of the data written to it
+type Encoder struct {
+	payloadWriter
+	header   bool     // whether or not the header has been written yet
+	checksum checksum // checksum of the data written so far
+	crc      uint64   // checksum written by the last call to Close
+	in       []byte   // buffer for ReadFrom
+	jobs     int      // goroutines used to encode large writes
 }
 
-func NewEncoder(enc *Encoding, w io.Writer) io.WriteCloser {
-	return &encoder{enc: enc, w: w}
+// NewEncoder creates an Encoder which writes data encoded with enc to w.
+// Close must be called to write the checksum.
+func NewEncoder(enc *Encoding, w io.Writer) *Encoder {
+	return &Encoder{payloadWriter: payloadWriter{enc: enc, w: w}, checksum: enc.newChecksum()}
 }
 
-func (e *encoder) Write(p []byte) (n int, err error) {
+// SetJobs sets the number of goroutines used to encode large writes.
+// Each write is split into pieces which are encoded concurrently
+// and written in order.
+// If n is less than 2, writes are encoded without any extra goroutines.
+func (e *Encoder) SetJobs(n int) {
+	e.jobs = n
+}
+
+func (e *Encoder) Write(p []byte) (n int, err error) {
 	if !e.header {
 		e.header = true
 
-		// write delim character
-		delimChar := e.enc.DelimCharAsUTF8()
-		if _, err := e.w.Write(delimChar); err != nil {
-			return 0, err
-		}
-
-		// write encoded header
-		header := make([]byte, e.enc.EncodedHeaderLen())
-		headerSize := e.enc.EncodeHeader(header)
-		if _, err := e.w.Write(header[:headerSize]); err != nil {
+		// write delim character, encoded header, and delim character
+		buf := e.buffer(2*utf8.UTFMax + e.enc.EncodedHeaderLen())
+		size := utf8.EncodeRune(buf, e.enc.delimChar)
+		size += e.enc.EncodeHeader(buf[size:])
+		size += utf8.EncodeRune(buf[size:], e.enc.delimChar)
+		if _, err := e.w.Write(buf[:size]); err != nil {
 			return 0, err
 		}
+	}
 
-		// write delim character
-		if _, err := e.w.Write(delimChar); err != nil {
+	if e.jobs > 1 && len(p) >= e.jobs*chunkLen {
+		if err := e.writePayloadParallel(p, e.jobs, &e.checksum); err != nil {
 			return 0, err
 		}
+		return len(p), nil
 	}
 
-	dst := make([]byte, e.enc.EncodedPayloadMaxLen(len(p)))
-	size := e.enc.EncodePayload(dst, p)
-
-	n, err = e.w.Write(dst[:size])
-	if err != nil {
+	e.checksum.update(p)
+	if err := e.writePayload(p); err != nil {
 		return 0, err
 	}
-	return len(p), err
+	return len(p), nil
+}
+
+// ReadFrom writes the data read from r until EOF
+// and returns the number of bytes read.
+// Like Write, Close must be called afterwards.
+func (e *Encoder) ReadFrom(r io.Reader) (n int64, err error) {
+	// each goroutine encodes parallelLen bytes
+	size := chunkLen
+	if e.jobs > 1 {
+		size = e.jobs * parallelLen
+	}
+	if len(e.in) != size {
+		e.in = make([]byte, size)
+	}
+	return readFrom(e, r, e.in, e.jobs > 1)
 }
 
-func (e *encoder) Close() error {
-	// write delim character
-	if _, err := e.w.Write(e.enc.DelimCharAsUTF8()); err != nil {
+// Close writes the end of the payload and the checksum.
+// The Encoder can be used to write another file afterwards.
+func (e *Encoder) Close() error {
+	// write the last group of 5-bit, 6-bit, or base-N encoding
+	if err := e.closePayload(); err != nil {
 		return err
 	}
 
-	// write encoded checksum
-	dst := make([]byte, e.enc.EncodedChecksumMaxLen())
-	size := e.enc.EncodeChecksum(dst)
-	if _, err := e.w.Write(dst[:size]); err != nil {
+	e.crc = e.checksum.crc()
+	e.checksum.reset()
+
+	// write delim character, encoded checksum, and terminator character
+	buf := e.buffer(2*utf8.UTFMax + e.enc.EncodedChecksumMaxLen())
+	size := utf8.EncodeRune(buf, e.enc.delimChar)
+	size += e.enc.EncodeChecksum(buf[size:], e.crc)
+	if t := profiles[e.enc.profile].terminator; t != 0 {
+		size += utf8.EncodeRune(buf[size:], t)
+	}
+	if _, err := e.w.Write(buf[:size]); err != nil {
 		return err
 	}
 
@@ -411,55 +1159,64 @@ func (e *encoder) Close() error {
 //
 
 type CorruptHeaderError struct {
-	msg          string
-	HeaderLength int // length of the decoded header in bits
-	CRCFail      bool // crc failed
+	HeaderLength   int  // length of the decoded header in bits
+	ExpectedLength int  // expected length of the header in bits if not 8
+	CRCFail        bool // crc failed
+	Offset         int  // offset in bytes of the encoded header in the input
+	RuneOffset     int  // offset in characters of the encoded header in the input
 }
 
 func (e CorruptHeaderError) Error() string {
-	e.msg = "corrupt header: "
+	msg := "corrupt header at byte " + strconv.Itoa(e.Offset) +
+	       " (character " + strconv.Itoa(e.RuneOffset) + ")"
 
-	if e.HeaderLength < 8 {
-		e.msg += "header shorter than expected: " +
-				"expected 8, got " + strconv.Itoa(e.HeaderLength)
-	} else if e.CRCFail {
-		e.msg += "crc for header failed"
+	if e.kind() == ErrShortHeader {
+		expectedLength := 8
+		if e.ExpectedLength != 0 {
+			expectedLength = e.ExpectedLength
+		}
+		msg += ": " + ErrShortHeader.Error() +
+				": expected " + strconv.Itoa(expectedLength) +
+				", got " + strconv.Itoa(e.HeaderLength)
+	} else if e.kind() != nil {
+		msg += ": " + e.kind().Error()
 	}
 
-	return e.msg
+	return msg
 }
 
 type CorruptPayloadError struct {
-	msg                 string
-	NotValidUTF8        bool // payload contains no utf8 characters
+	NotValidUTF8        bool // payload contains bytes which aren't valid utf8
 	IncompleteByte      bool // decoding resulted in an incomplete byte
 	ShortCRC            bool // decoded crc is too short
 	CRCFail             bool // checksum doesn't match calculated crc
 	NoDelimChar         bool // no delim char between payload and checksum
 	UnexpectedDelimChar bool // delim char after checksum (use NewCatDecoder)
+	NonZeroPadding      bool // padding at the end of a 5-bit or 6-bit payload isn't zero
+	ChunkOverflow       bool // base-N chunk is too large for its number of bytes
+
+	Offset     int    // offset in bytes in the input where the error was found
+	RuneOffset int    // offset in characters in the input where the error was found
+	Expected   uint64 // for CRCFail, the checksum in the file
+	Actual     uint64 // for CRCFail, the checksum of the decoded payload
 }
 
 func (e CorruptPayloadError) Error() string {
-	e.msg = "corrupt payload: "
+	msg := "corrupt payload at byte " + strconv.Itoa(e.Offset) +
+	       " (character " + strconv.Itoa(e.RuneOffset) + "): "
 
 	switch {
-	case e.NotValidUTF8:
-		e.msg += "payload contains non-valid UTF-8"
-	case e.IncompleteByte:
-		e.msg += "payload contains incomplete byte"
-	case e.ShortCRC:
-		e.msg += "crc is too short"
 	case e.CRCFail:
-		e.msg += "crc for payload failed"
-	case e.NoDelimChar:
-		e.msg += "missing delim char"
-	case e.UnexpectedDelimChar:
-		e.msg += "unexpected delim char"
+		msg += ErrCRCMismatch.Error() +
+				": expected " + strconv.FormatUint(e.Expected, 16) +
+				", got " + strconv.FormatUint(e.Actual, 16)
+	case e.kind() != nil:
+		msg += e.kind().Error()
 	default:
-		e.msg += "unknown error"
+		msg += "unknown error"
 	}
 
-	return e.msg
+	return msg
 }
 
 // DecodeHeader takes an encoded header
@@ -468,36 +1225,86 @@ func (e CorruptPayloadError) Error() string {
 // the payload and checksum.
 // These can then be passed to NewEncoding to
 // create an Encoding.
+// The profile of version 2 headers is ignored
+// and headers using the bmp-only 4-bit encoding are rejected,
+// use DecodeEncoding if the header may use a profile.
+// Headers of encoding types which NewEncoding encodes with a profile,
+// such as 6-bit and 8-bit encoding, are decoded with the table of that profile.
 func DecodeHeader(src []byte) (version, encodingType, checksumType int, err error) {
-	enc := NewEncoding(1, 2, 0)
+	version, encodingType, checksumType, err = DecodeCustomHeader(V1Table[:], src)
+	if err == nil {
+		return version, encodingType, checksumType, nil
+	}
+
+	for id, p := range profiles {
+		v, e, c, headerProfile, profileErr := decodeHeader(p.table, src)
+		if profileErr != nil || headerProfile != id {
+			continue
+		}
+		if encodingID, ok := encodingProfile(e); ok && encodingID == id {
+			return v, e, c, nil
+		}
+	}
 
-	i := 6
-	var header byte
+	// the error for the default table is
+	// the most useful if no profile matches
+	return 0, 0, 0, err
+}
+
+// DecodeCustomHeader is like DecodeHeader
+// but decodes a header encoded with table.
+// The settings can then be passed to NewCustomEncoding
+// along with the same table.
+func DecodeCustomHeader(table []string, src []byte) (version, encodingType, checksumType int, err error) {
+	var profile int
+	version, encodingType, checksumType, profile, err = decodeHeader(table, src)
+
+	// the bmp-only 4-bit encoding can't be created with NewCustomEncoding
+	if err == nil && version == 1 && profile != ProfileDefault {
+		return 0, 0, 0, InvalidEncodingError{InvalidEncodingType: true}
+	}
+	return version, encodingType, checksumType, err
+}
+
+// decodeHeader decodes a header encoded with table
+// and also returns the profile of version 2 headers
+// or of the bmp-only 4-bit encoding
+func decodeHeader(table []string, src []byte) (version, encodingType, checksumType, profile int, err error) {
+	// header always uses 2-bit encoding
+	decodeMap := make(map[rune]byte, 4)
+	for i, v := range table[:4] {
+		char, _ := utf8.DecodeRuneInString(v)
+		decodeMap[char] = byte(i)
+	}
+
+	i := 14
+	var header uint16
 	for _, char := range string(src) {
 		if i < 0 {
 			break
 		}
 
-		n, ok := enc.decodeMap[char]
+		n, ok := decodeMap[char]
 		if ok {
-			header = header | n<<i
+			header = header | uint16(n)<<i
 			i -= 2
 		}
 	}
+	length := 14 - i
 
 	// less than 4 runes were read from src
-	if !(i < 0) {
-		return 0, 0, 0, CorruptHeaderError{CRCFail: false, HeaderLength: 6-i}
+	if length < 8 {
+		return 0, 0, 0, 0, CorruptHeaderError{CRCFail: false, HeaderLength: length}
 	}
 
 	// crc failed
-	if CRC2(header) != 0 {
-		return 0, 0, 0, CorruptHeaderError{CRCFail: true, HeaderLength: 8}
+	if CRC2(byte(header>>8)) != 0 {
+		return 0, 0, 0, 0, CorruptHeaderError{CRCFail: true, HeaderLength: 8}
 	}
 
-	version = int(header>>6 & 3 + 1)
-	encodingType = int(header>>4 & 3 + 2)
-	rawChecksumType := header>>2 & 3
+	version = int(header>>14 & 3 + 1)
+	encodingID := int(header>>12 & 3)
+	rawChecksumType := header>>10 & 3
 	switch rawChecksumType {
 	case 0, 1, 2:
 		checksumType = int(rawChecksumType * 8)
@@ -505,27 +1312,213 @@ func DecodeHeader(src []byte) (version, encodingType, checksumType int, err erro
 		checksumType = 32
 	}
 
+	if version == 2 {
+		// less than 8 runes were read from src
+		if length < 16 {
+			return 0, 0, 0, 0, CorruptHeaderError{CRCFail: false,
+					HeaderLength: length, ExpectedLength: 16}
+		}
+
+		// crc failed
+		if CRC2(byte(header)) != 0 {
+			return 0, 0, 0, 0, CorruptHeaderError{CRCFail: true,
+					HeaderLength: 16, ExpectedLength: 16}
+		}
+
+		profile = int(header>>4 & 15)
+		encodingID += int(header>>2 & 3) << 2
+	}
+
+	switch encodingID {
+	case 0, 1, 2:
+		encodingType = encodingID + 2
+	case 3: // 4-bit encoding using the bmp-only profile
+		if version == 2 && profile != ProfileBMPOnly {
+			return 0, 0, 0, 0, InvalidEncodingError{InvalidEncodingType: true}
+		}
+
+		encodingType = 4
+		profile = ProfileBMPOnly
+	case 4:
+		encodingType = 5
+	case 5:
+		encodingType = 8
+	case 6:
+		encodingType = 6
+	case 7:
+		encodingType = RadixEncoding
+	default:
+		return 0, 0, 0, 0, InvalidEncodingError{InvalidEncodingType: true}
+	}
+
 	err = ValidEncoding(version, encodingType, checksumType)
 
-	return version, encodingType, checksumType, err
+	return version, encodingType, checksumType, profile, err
 }
 
 // GuessEncodingType uses heuristics to guess the encoding of the payload
 func GuessEncodingType(p []byte) int {
-	enc := NewEncoding(1, 4, 0)
+	return guessEncodingType(ExtendedTable[:], p)
+}
+
+func guessEncodingType(table []string, p []byte) int {
+	decodeMap := make(map[rune]byte, len(table))
+	for i, v := range table {
+		if v != "" {
+			char, _ := utf8.DecodeRuneInString(v)
+			decodeMap[char] = byte(i)
+		}
+	}
 
 	encodingType := 2
 	for _, v := range string(p) {
-		n := enc.decodeMap[v]
+		n := decodeMap[v]
 
 		if encodingType < 3 && 4 <= n && n < 8 {
 			encodingType = 3
-		} else if 8 <= n && n < 16 {
-			return 4
+		} else if encodingType < 4 && 8 <= n && n < 16 {
+			encodingType = 4
+		} else if encodingType < 5 && 16 <= n && n < 32 {
+			encodingType = 5
+		} else if encodingType < 6 && 32 <= n && n < 64 {
+			encodingType = 6
+		} else if 64 <= n {
+			return 8
+		}
+	}
+
+	return encodingType
+}
+
+// Candidate is a possible encoding for a payload
+// whose header can't be trusted
+type Candidate struct {
+	Version      int
+	EncodingType int
+	ChecksumType int
+	Profile      string // empty if found by DetectCustomEncoding
+	CRCMatch     bool // checksum was decoded and matches the payload
+	Guessed      bool // EncodingType agrees with GuessEncodingType
+	InvalidChars int  // characters of the payload which aren't in the table
+}
+
+// DetectEncoding tries every valid combination of
+// encoding and checksum type on the payload + delim + checksum in src
+// and returns the combinations which decode without error.
+// Candidates whose checksum matches come first,
+// ranked by the strength of their checksum,
+// since a weaker checksum is more likely to match by chance,
+// and then by the number of characters which aren't in the table.
+// They are followed by those which agree with GuessEncodingType.
+// Combinations without a checksum can't be verified,
+// so they are only returned if they agree with GuessEncodingType.
+// The payload is only decoded once for each profile and encoding.
+func DetectEncoding(src []byte) []Candidate {
+	var candidates []Candidate
+	for id, p := range profiles {
+		for _, c := range DetectCustomEncoding(p.table, p.delimChar, src) {
+			c.Profile = p.name
+			c.Version = profileVersion(id, c.EncodingType)
+			candidates = append(candidates, c)
 		}
 	}
 
-	return encodingType
+	sortCandidates(candidates)
+	return candidates
+}
+
+// DetectCustomEncoding is like DetectEncoding
+// but for payloads encoded with table and delimChar.
+func DetectCustomEncoding(table []string, delimChar rune, src []byte) []Candidate {
+	i := bytes.IndexRune(src, delimChar)
+	if i < 0 {
+		return nil
+	}
+	payload, checksum := src[:i], src[i+utf8.RuneLen(delimChar):]
+	guess := guessEncodingType(table, payload)
+	runes := runeCount(payload)
+
+	var candidates []Candidate
+	var dst []byte
+	for _, encodingType := range []int{2, 3, 4, 5, 6, 8, RadixEncoding} {
+		// 5-bit, 6-bit, 8-bit, and base-N encoding require a version 2 header
+		version := 1
+		if encodingType >= 5 || encodingType == RadixEncoding {
+			version = 2
+		}
+		if ValidEncoding(version, encodingType, 0) != nil || !tableSupports(table, encodingType) {
+			continue
+		}
+
+		// the payload doesn't depend on the checksum type,
+		// so it is only decoded once for each encoding
+		enc := NewCustomTableEncoding(table, delimChar, version, encodingType, 0)
+		if size := enc.DecodedPayloadMaxLen(len(payload)); cap(dst) < size {
+			dst = make([]byte, size)
+		}
+		n, _, err := enc.DecodePayload(dst[:cap(dst)], payload)
+		if err != nil {
+			continue
+		}
+		data := dst[:n]
+		invalid := runes - enc.countChars(payload)
+
+		// stronger checksums are less likely to match by chance,
+		// so only the strongest which matches is kept
+		matched := false
+		for _, checksumType := range []int{32, 16, 8} {
+			enc := NewCustomTableEncoding(table, delimChar, version, encodingType, checksumType)
+			if _, _, err := enc.DecodeChecksum(checksum, enc.CRC(data)); err != nil {
+				continue
+			}
+
+			candidates = append(candidates, Candidate{
+				Version:      version,
+				EncodingType: encodingType,
+				ChecksumType: checksumType,
+				CRCMatch:     true,
+				Guessed:      encodingType == guess,
+				InvalidChars: invalid,
+			})
+			matched = true
+			break
+		}
+
+		if !matched && encodingType == guess {
+			candidates = append(candidates, Candidate{
+				Version:      version,
+				EncodingType: encodingType,
+				Guessed:      true,
+				InvalidChars: invalid,
+			})
+		}
+	}
+
+	sortCandidates(candidates)
+	return candidates
+}
+
+// sortCandidates sorts candidates from most to least likely
+func sortCandidates(candidates []Candidate) {
+	slices.SortStableFunc(candidates, func(a, b Candidate) int {
+		switch {
+		case a.CRCMatch != b.CRCMatch:
+			if a.CRCMatch {
+				return -1
+			}
+			return 1
+		case a.ChecksumType != b.ChecksumType:
+			return b.ChecksumType - a.ChecksumType
+		case a.InvalidChars != b.InvalidChars:
+			return a.InvalidChars - b.InvalidChars
+		case a.Guessed != b.Guessed:
+			if a.Guessed {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	})
 }
 
 // Decode decodes the data + delim + checksum in src
@@ -536,10 +1529,10 @@ func GuessEncodingType(p []byte) int {
 // n is the number of bytes written to dst and
 // m is the number of bytes read from src.
 func (enc *Encoding) Decode(dst, src []byte) (n, m int, err error) {
-	i := strings.IndexRune(string(src), enc.delimChar)
+	i := bytes.IndexRune(src, enc.delimChar)
 
 	if i < 0 {
-		return 0, 0, CorruptPayloadError{NoDelimChar: true}
+		return 0, 0, errorAt(CorruptPayloadError{NoDelimChar: true}, src, len(src))
 	}
 
 	n, m, err = enc.DecodePayload(dst, src[:i])
@@ -547,42 +1540,91 @@ func (enc *Encoding) Decode(dst, src []byte) (n, m int, err error) {
 		return n, m, err
 	}
 
-	_, mm, err := enc.DecodeChecksum(src[i+utf8.RuneLen(enc.delimChar):])
+	i += utf8.RuneLen(enc.delimChar)
+	_, mm, err := enc.DecodeChecksum(src[i:], enc.CRC(dst[:n]))
+	if err != nil {
+		err = errorAt(err, src, i)
+	}
 
 	return n, m + mm + utf8.RuneLen(enc.delimChar), err
 }
 
+// AppendDecode decodes the ZWC file in src,
+// appends the data to dst, and returns the extended buffer.
+// Like NewDecoder, the encoding is decoded from the header
+// and anything before the file signature is discarded.
+// If the file is corrupt, the data decoded so far is appended.
+func AppendDecode(dst, src []byte) ([]byte, error) {
+	enc, end, err := decodeEncodingFromReader(bytes.NewReader(src), 0)
+	if err != nil {
+		return dst, err
+	}
+
+	src = src[end.offset:]
+	dst = slices.Grow(dst, enc.DecodedPayloadMaxLen(len(src)))
+	n, _, err := enc.Decode(dst[len(dst):cap(dst)], src)
+	return dst[:len(dst)+n], moveError(err, end.offset, end.runeOffset)
+}
+
+// DecodeString returns the data in the ZWC file s.
+// It is like AppendDecode.
+func DecodeString(s string) ([]byte, error) {
+	return AppendDecode(nil, []byte(s))
+}
+
 // DecodePayload decodes the payload in src
 // and writes it to dst.
 // n is the number of bytes written to dst and
 // m is the number of bytes read from src.
 func (enc *Encoding) DecodePayload(dst, src []byte) (n, m int, err error) {
-	n, m, err = enc.decodeRaw(dst, src)
+	return enc.decodePayload(dst, src, true)
+}
+
+// decodePayload is like DecodePayload but if final is false,
+// src doesn't have to end at the end of the payload.
+// Errors are found at the first byte of src which wasn't decoded.
+func (enc *Encoding) decodePayload(dst, src []byte, final bool) (n, m int, err error) {
+	n, m, err = enc.decodeRaw(dst, src, final)
 
-	if enc.checksumType != 0 {
-		enc.checksum.Update(dst[:n])
+	// an incomplete byte is expected if src doesn't end the payload,
+	// so its position isn't needed
+	if v, ok := err.(CorruptPayloadError); ok && v.IncompleteByte && !final {
+		return n, m, err
 	}
 
+	if err != nil {
+		err = errorAt(err, src, m)
+	}
 	return n, m, err
 }
 
 // DecodeChecksum decodes the checksum in p and returns the checksum.
-// If the checksum is decoded successfully and the checksum matches,
-// err is nil.
+// If the checksum is decoded successfully and matches crc,
+// the checksum of the decoded payload, err is nil.
 // m is the number of bytes read from p.
-func (enc *Encoding) DecodeChecksum(p []byte) (checksum uint64, m int, err error) {
+func (enc *Encoding) DecodeChecksum(p []byte, crc uint64) (checksum uint64, m int, err error) {
 	if enc.checksumType == 0 {
 		return 0, 0, nil
 	}
 
 	checksumSlice := make([]byte, enc.DecodedPayloadMaxLen(len(p)))
 
-	n, m, err := enc.decodeRaw(checksumSlice, p)
+	n, m, err := enc.decodePayload(checksumSlice, p, true)
+
+	// the message after the checksum doesn't have to be valid UTF-8
+	if v, ok := err.(CorruptPayloadError); ok && v.NotValidUTF8 && n >= enc.checksumType/8 {
+		err = nil
+	}
+
+	// the rest of the checksum may not have been read yet
+	if n < enc.checksumType/8 {
+		return 0, m, errorAt(CorruptPayloadError{ShortCRC: true}, p, m)
+	}
 
 	v, ok := err.(CorruptPayloadError)
 	if ok {
 		if v.IncompleteByte {
-			return 0, m, CorruptPayloadError{ShortCRC: true}
+			return 0, m, errorAt(CorruptPayloadError{ShortCRC: true}, p, m)
 		} else {
 			return 0, m, err
 		}
@@ -590,10 +1632,6 @@ func (enc *Encoding) DecodeChecksum(p []byte) (checksum uint64, m int, err error
 		return 0, m, err
 	}
 
-	if n < enc.checksumType/8 {
-		return 0, m, CorruptPayloadError{ShortCRC: true}
-	}
-
 	checksumSlice = checksumSlice[:enc.checksumType/8]
 
 	// convert checksumSlice to uint64
@@ -602,11 +1640,9 @@ func (enc *Encoding) DecodeChecksum(p []byte) (checksum uint64, m int, err error
 		checksum = checksum | uint64(checksumSlice[i])<<(i*8)
 	}
 
-	enc.crc = enc.checksum.CRC()
-	enc.checksum.Reset()
-
-	if enc.crc != checksum {
-		return checksum, m, CorruptPayloadError{CRCFail: true}
+	// the error is found at the start of the checksum
+	if crc != checksum {
+		return checksum, m, CorruptPayloadError{CRCFail: true, Expected: checksum, Actual: crc}
 	}
 
 	return checksum, m, nil
@@ -614,19 +1650,35 @@ func (enc *Encoding) DecodeChecksum(p []byte) (checksum uint64, m int, err error
 
 // n is number of bytes written to dst.
 // m is the number of bytes processed from src.
-func (enc *Encoding) decodeRaw(dst, src []byte) (n, m int, err error) {
+// final is whether src ends at the end of the payload,
+// which only matters for 5-bit, 6-bit, and base-N encoding.
+func (enc *Encoding) decodeRaw(dst, src []byte, final bool) (n, m int, err error) {
+	if packed(enc.encodingType) {
+		return enc.decodePacked(dst, src, final)
+	} else if enc.encodingType == RadixEncoding {
+		return enc.decodeRadix(dst, src, final)
+	}
+
 	var output byte
-	var shift int
+	var firstShift int // shift of the first character of each byte
 
 	switch enc.encodingType {
 	case 2, 3:
-		shift = 6
+		firstShift = 6
 	case 4:
-		shift = 4
+		firstShift = 4
+	case 8:
+		firstShift = 0
 	}
+	shift := firstShift
 
-	for i, r := range string(src) {
-		rv, ok := enc.decodeMap[r]
+	var page int // page of the last character in the decode table
+	for i := 0; i < len(src); {
+		rv, size, ok := enc.nextChar(src[i:], &page)
+		if !ok && invalidUTF8(src[i:], size) {
+			return n, i, CorruptPayloadError{NotValidUTF8: true}
+		}
+		i += size
 		if ok {
 			output = rv<<shift | output
 			shift -= enc.encodingType
@@ -635,190 +1687,602 @@ func (enc *Encoding) decodeRaw(dst, src []byte) (n, m int, err error) {
 				dst[n] = output
 				output = 0
 				n++
-				m = i + utf8.RuneLen(r)
-
-				switch enc.encodingType {
-				case 2, 3:
-					shift = 6
-				case 4:
-					shift = 4
-				}
+				m = i
+				shift = firstShift
 			}
 		}
 	}
 
-	switch enc.encodingType {
-	case 2, 3:
-		if shift != 6 {
-			return n, m, CorruptPayloadError{IncompleteByte: true}
-		}
-	case 4:
-		if shift != 4 {
-			return n, m, CorruptPayloadError{IncompleteByte: true}
-		}
+	if shift != firstShift {
+		return n, m, CorruptPayloadError{IncompleteByte: true}
 	}
 
 	return n, m, nil
 }
 
-// DecodedPayloadMaxLen returns
-// the maximum length of the decoded payload
-// where n is the length of the encoded payload
-func (enc *Encoding) DecodedPayloadMaxLen(n int) int {
-	switch enc.encodingType {
-	case 2:
-		return n / 12
-	case 3:
-		return n / 9
-	case 4:
-		return n / 6
+// decodePacked decodes src encoded by encodePacked.
+// Every group of characters decodes to groupLen bytes.
+// If final is false, only complete groups of characters are decoded
+// and the rest must be decoded again with the characters which follow.
+// If final is true, the last group may be shorter
+// but its padding must be zero.
+func (enc *Encoding) decodePacked(dst, src []byte, final bool) (n, m int, err error) {
+	e := enc.encodingType
+	groupChars := enc.encodedChars(enc.groupLen())
+	var bits uint16 // bits which haven't been decoded yet
+	var nBits, nChars int
+	var groupN int // bytes decoded from complete groups
+	var end int    // index in src after the last character decoded
+
+	var page int // page of the last character in the decode table
+	for i := 0; i < len(src); {
+		rv, size, ok := enc.nextChar(src[i:], &page)
+		if !ok && invalidUTF8(src[i:], size) {
+			return n, i, CorruptPayloadError{NotValidUTF8: true}
+		}
+		i += size
+		if !ok {
+			continue
+		}
+
+		bits = bits<<e | uint16(rv)
+		nBits += e
+		nChars++
+		end = i
+
+		if nBits >= 8 {
+			nBits -= 8
+			dst[n] = byte(bits >> nBits)
+			n++
+			bits &= 1<<nBits - 1
+		}
+
+		if nChars == groupChars {
+			nChars = 0
+			groupN = n
+			m = end
+		}
 	}
 
-	return 0
+	if nChars == 0 {
+		return n, m, nil
+	} else if !final {
+		return groupN, m, CorruptPayloadError{IncompleteByte: true}
+	}
+
+	// a group of k bytes uses ceil(8k/e) characters,
+	// so there are always fewer than e bits of padding
+	if nChars*e%8 >= e {
+		return groupN, m, CorruptPayloadError{IncompleteByte: true}
+	}
+
+	if bits != 0 {
+		return groupN, m, CorruptPayloadError{NonZeroPadding: true}
+	}
+
+	return n, end, nil
 }
 
-func (enc *Encoding) encodedMinLen(n int) int {
-	switch enc.encodingType {
-	case 2:
-		return n * 12
-	case 3:
-		return n * 9
-	case 4:
-		return n * 6
+// decodeRadix decodes src encoded by encodeRadix.
+// If final is false, only complete chunks of 8 bytes are decoded
+// and the rest must be decoded again with the characters which follow.
+// If final is true, the last chunk may be shorter.
+func (enc *Encoding) decodeRadix(dst, src []byte, final bool) (n, m int, err error) {
+	radix := uint64(len(enc.encode))
+	var v uint64
+	var overflow bool // v doesn't fit in 8 bytes
+	var nChars int
+	var end int // index in src after the last character decoded
+
+	var page int // page of the last character in the decode table
+	for i := 0; i < len(src); {
+		rv, size, ok := enc.nextChar(src[i:], &page)
+		if !ok && invalidUTF8(src[i:], size) {
+			return n, i, CorruptPayloadError{NotValidUTF8: true}
+		}
+		i += size
+		if !ok {
+			continue
+		}
+
+		hi, lo := bits.Mul64(v, radix)
+		var carry uint64
+		v, carry = bits.Add64(lo, uint64(rv), 0)
+		overflow = overflow || hi != 0 || carry != 0
+		nChars++
+		end = i
+
+		if nChars == enc.radixChars[8] {
+			if overflow {
+				return n, m, CorruptPayloadError{ChunkOverflow: true}
+			}
+			for shift := 56; shift >= 0; shift -= 8 {
+				dst[n] = byte(v >> shift)
+				n++
+			}
+			v, overflow, nChars = 0, false, 0
+			m = end
+		}
 	}
 
-	return 0
+	if nChars == 0 {
+		return n, m, nil
+	} else if !final {
+		return n, m, CorruptPayloadError{IncompleteByte: true}
+	}
+
+	// find the length of the last chunk from its number of characters
+	k := 1
+	for k < 8 && enc.radixChars[k] != nChars {
+		k++
+	}
+	if enc.radixChars[k] != nChars {
+		return n, m, CorruptPayloadError{IncompleteByte: true}
+	}
+	if overflow || v >= 1<<(8*k) {
+		return n, m, CorruptPayloadError{ChunkOverflow: true}
+	}
+
+	for shift := 8*k - 8; shift >= 0; shift -= 8 {
+		dst[n] = byte(v >> shift)
+		n++
+	}
+	return n, end, nil
+}
+
+// DecodedPayloadMaxLen returns
+// the maximum length of the decoded payload
+// where n is the length of the encoded payload
+func (enc *Encoding) DecodedPayloadMaxLen(n int) int {
+	return enc.decodedBytes(n / enc.minCharLen)
 }
 
-type decoder struct {
-	r  io.Reader
-	cd io.Reader // customDecoder
+func (enc *Encoding) encodedMinLen(n int) int {
+	return enc.encodedChars(n) * enc.minCharLen
 }
 
-// NewDecoder creates a decoder which
+// NewDecoder creates a Decoder which
 // decodes the header from r,
 // therefore it doesn't require an Encoding.
 // It takes the entirety of the encoded data and
 // no preprocessing is need.
+// r is read through a bufio.Reader, so the header
+// and the payload are both read in large blocks.
 // If you want to override the encoding settings
 // use NewCustomDecoder.
-func NewDecoder(r io.Reader) io.Reader {
-	return &decoder{r:r}
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReaderSize(r, chunkLen)}
 }
 
-func (d *decoder) Read(p []byte) (n int, err error) {
-	if d.cd == nil { // header hasn't been decoded yet
-		// decode header
-		v, e, c, err := DecodeHeaderFromReader(d.r)
-		if err != nil {
-			return 0, err
-		}
+// DecodeHeaderFromReader reads from r until the end of the header
+// and decodes it with DecodeHeader.
+// Anything in r before the file signature is discarded.
+// The file signature may be TagDelimChar for 6-bit encoding.
+// Nothing after the header is read from r,
+// which is read one byte at a time unless it is an io.RuneReader.
+// To read in large blocks, wrap r in a bufio.Reader
+// and pass the same bufio.Reader to NewCustomDecoder.
+func DecodeHeaderFromReader(r io.Reader) (version, encodingType, checksumType int, err error) {
+	encodedHeader, start, _, err := readHeader(r, 0, delimChars...)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	version, encodingType, checksumType, err = DecodeHeader(encodedHeader)
+	return version, encodingType, checksumType, moveError(err, start.offset, start.runeOffset)
+}
+
+// DecodeCustomHeaderFromReader is like DecodeHeaderFromReader
+// but the header is delimited by delimChar and
+// decoded with DecodeCustomHeader.
+func DecodeCustomHeaderFromReader(table []string, delimChar rune, r io.Reader) (version, encodingType, checksumType int, err error) {
+	return DecoderOptions{}.DecodeCustomHeaderFromReader(table, delimChar, r)
+}
 
-		enc := NewEncoding(v, e, c)
-		d.cd = NewCustomDecoder(enc, d.r)
+// DecodeCustomHeaderFromReader is like the function DecodeCustomHeaderFromReader
+// but returns a LimitError if the file signature doesn't start
+// within the first opts.MaxScanBytes bytes of r
+func (opts DecoderOptions) DecodeCustomHeaderFromReader(table []string, delimChar rune, r io.Reader) (version, encodingType, checksumType int, err error) {
+	encodedHeader, start, _, err := readHeader(r, opts.MaxScanBytes, delimChar)
+	if err != nil {
+		return 0, 0, 0, err
 	}
 
-	return d.cd.Read(p)
+	version, encodingType, checksumType, err = DecodeCustomHeader(table, encodedHeader)
+	return version, encodingType, checksumType, moveError(err, start.offset, start.runeOffset)
 }
 
-func DecodeHeaderFromReader(r io.Reader) (version, encodingType, checksumType int, err error) {
-	var encodedHeader []byte
-	char := make([]byte, utf8.UTFMax)
+// DecodeEncodingFromReader reads from r until the end of the header
+// and decodes it with DecodeEncoding.
+// Anything in r before the file signature is discarded.
+// Like DecodeHeaderFromReader, nothing after the header is read from r.
+// The file signature may be the delim char of any of the built-in profiles.
+func DecodeEncodingFromReader(r io.Reader) (*Encoding, error) {
+	return DecoderOptions{}.DecodeEncodingFromReader(r)
+}
+
+// DecodeEncodingFromReader is like the function DecodeEncodingFromReader
+// but returns a LimitError if the file signature doesn't start
+// within the first opts.MaxScanBytes bytes of r
+func (opts DecoderOptions) DecodeEncodingFromReader(r io.Reader) (*Encoding, error) {
+	enc, _, err := decodeEncodingFromReader(r, opts.MaxScanBytes)
+	return enc, err
+}
+
+// decodeEncodingFromReader is like DecodeEncodingFromReader
+// but also returns the position in r after the header.
+// maxScan is passed to readHeader.
+func decodeEncodingFromReader(r io.Reader, maxScan int64) (*Encoding, position, error) {
+	encodedHeader, start, end, err := readHeader(r, maxScan, delimChars...)
+	if err != nil {
+		return nil, end, err
+	}
+
+	enc, err := DecodeEncoding(encodedHeader)
+	return enc, end, moveError(err, start.offset, start.runeOffset)
+}
+
+// position is an offset in the input in bytes and in characters
+type position struct {
+	offset     int
+	runeOffset int
+}
+
+// readHeader reads from r until the second delim char
+// and returns the encoded header between the first and second delim char.
+// The first of delimChars found in r is used as the delim char.
+// start is the position of the encoded header
+// and end is the position after the second delim char.
+// If r is an io.RuneReader, such as a *bufio.Reader, characters are read with ReadRune.
+// Otherwise r is read one byte at a time so nothing after the header is read.
+// If maxScan isn't 0, a LimitError is returned if the first delim char
+// doesn't start within the first maxScan bytes.
+func readHeader(r io.Reader, maxScan int64, delimChars ...rune) (encodedHeader []byte, start, end position, err error) {
+	rr, ok := r.(io.RuneReader)
+	if !ok {
+		rr = byteRuneReader{r}
+	}
+
+	var delimChar rune
 	var delimCount int
 	for {
-		// read one character into char
-		var i int
-		for i == 0 || !utf8.Valid(char) {
-			n, err := r.Read(char[i:i+1])
-			i += n
-			if err != nil {
-				return 0, 0, 0, err
-			}
+		if delimCount == 0 && maxScan > 0 && int64(end.offset) >= maxScan {
+			return nil, start, end, LimitError{ScanBytes: true, Limit: maxScan}
 		}
 
-		c, _ := utf8.DecodeRune(char[:i])
-		if c == V1DelimChar {
+		c, size, err := rr.ReadRune()
+		if err != nil {
+			return nil, start, end, err
+		}
+		end.offset += size
+		end.runeOffset++
+
+		if delimCount == 0 && slices.Contains(delimChars, c) {
+			delimChar = c
+			delimCount += 1
+			start = end
+		} else if delimCount > 0 && c == delimChar {
 			delimCount += 1
 			if delimCount >= 2 {
 				break
 			}
 		} else if delimCount == 1 {
-			encodedHeader = append(encodedHeader, char[:i]...)
+			encodedHeader = utf8.AppendRune(encodedHeader, c)
 		}
+	}
+
+	return encodedHeader, start, end, nil
+}
+
+// A byteRuneReader reads characters from r one byte at a time,
+// so it never reads past the end of a character
+type byteRuneReader struct {
+	r io.Reader
+}
 
-		// zero the slice
-		for i := range char {
-			char[i] = 0
+// ReadRune returns utf8.RuneError for invalid UTF-8
+// and size is the number of bytes read
+func (b byteRuneReader) ReadRune() (r rune, size int, err error) {
+	var char [utf8.UTFMax]byte
+	for size == 0 || !utf8.FullRune(char[:size]) {
+		n, err := b.r.Read(char[size:size+1])
+		size += n
+		if err != nil {
+			return 0, size, err
 		}
-		i = 0
 	}
 
-	return DecodeHeader(encodedHeader)
+	r, n := utf8.DecodeRune(char[:size])
+	if n != size {
+		r = utf8.RuneError
+	}
+	return r, size, nil
 }
 
-type customDecoder struct {
-	enc             *Encoding
+// A Decoder reads a ZWC file from a stream
+// and calculates the checksum of the data read from it
+type Decoder struct {
+	enc             *Encoding // nil until the header is decoded
 	r               io.Reader
-	buf             []byte // input buffer
+	checksum        checksum  // checksum of the data decoded so far
+	crc             uint64    // checksum of the payload once it is decoded
+	buf             []byte // input which hasn't been decoded yet
+	in              []byte // buffer for reading from r
 	delim           bool   // delim char has been encountered
 	encodedChecksum []byte // buffer for encoded checksum
+	checked         bool   // checksum has been decoded and matches
+	out             []byte // decoded data which hasn't been returned yet
+	outErr          error  // error to return after out
+	group           [8]byte // buffer for out
+	outBuf          []byte  // buffer for WriteTo
+	jobs            int     // goroutines used to decode large reads
+	bytesRead       int      // bytes read from r, including the header
+	runeOffset      int      // characters before the bytes in buf
+	checksumPos     position // position of the encoded checksum
+	opts            DecoderOptions
+	cat             bool     // files after the first are decoded too
+	files           int      // files whose header has been decoded
+	payload         payloadLimit // bytes of data returned from every file
+	next            []byte   // input from the start of the next file
+	nextPos         position // position of the start of the next file
+}
+
+// DecoderOptions limits the resources used by a Decoder,
+// such as when decoding untrusted text.
+// A limit of 0 means there is no limit.
+type DecoderOptions struct {
+	// MaxPayloadBytes is the maximum number of bytes of data
+	// which are decoded, counting the data of every file
+	MaxPayloadBytes int64
+
+	// MaxScanBytes is the maximum number of bytes before
+	// the file signature, which are read to look for it
+	MaxScanBytes int64
+
+	// MaxFiles is the maximum number of files which are decoded.
+	// Only a Decoder from NewCatDecoder decodes more than one file.
+	MaxFiles int
+}
+
+// A LimitError is returned when a limit of DecoderOptions is exceeded,
+// such as by a Decoder
+type LimitError struct {
+	PayloadBytes bool  // there is more data than MaxPayloadBytes
+	ScanBytes    bool  // the file signature isn't within MaxScanBytes
+	Files        bool  // there are more files than MaxFiles
+	Limit        int64 // the limit which was exceeded
+}
+
+func (e LimitError) Error() string {
+	msg := "limit exceeded: "
+
+	limit := strconv.FormatInt(e.Limit, 10)
+	switch {
+	case e.PayloadBytes:
+		msg += "data is longer than " + limit + " bytes"
+	case e.ScanBytes:
+		msg += "file signature not found in the first " + limit + " bytes"
+	case e.Files:
+		msg += "more than " + limit + " files"
+	}
+
+	return msg
 }
 
 // NewCustomDecoder requires an Encoding,
 // meaning the header must be decoded beforehand.
 // r must contain only the data + delim + checksum
-func NewCustomDecoder(enc *Encoding, r io.Reader) io.Reader {
-	return &customDecoder{enc: enc, r: r}
+func NewCustomDecoder(enc *Encoding, r io.Reader) *Decoder {
+	return &Decoder{enc: enc, r: r, checksum: enc.newChecksum()}
+}
+
+// SetOptions sets the limits of d.
+// It must be called before the first call to Read or WriteTo.
+func (d *Decoder) SetOptions(opts DecoderOptions) {
+	d.opts = opts
+	d.payload.limit = opts.MaxPayloadBytes
+}
+
+// LimitPayload returns a reader of the data read from r
+// which returns a LimitError once there is more than
+// opts.MaxPayloadBytes bytes of it, like a Decoder.
+// It is for readers of data which don't take DecoderOptions,
+// such as the reader returned by NewRawDecoder.
+func (opts DecoderOptions) LimitPayload(r io.Reader) io.Reader {
+	return &payloadLimitReader{r: r, payload: payloadLimit{limit: opts.MaxPayloadBytes}}
+}
+
+// A payloadLimit counts the bytes of data returned by a reader
+type payloadLimit struct {
+	limit   int64 // MaxPayloadBytes, or 0 if there is no limit
+	decoded int64 // bytes of data returned so far
+}
+
+// shorten returns p shortened to one byte more than the limit,
+// which is read to find out if there is more data
+func (l *payloadLimit) shorten(p []byte) []byte {
+	if l.limit > 0 && int64(len(p)) > l.limit-l.decoded {
+		return p[:l.limit-l.decoded+1]
+	}
+	return p
+}
+
+// count adds n bytes of data read into the shortened buffer
+// and returns the number of them within the limit,
+// with a LimitError instead of err if there were more
+func (l *payloadLimit) count(n int, err error) (int, error) {
+	l.decoded += int64(n)
+	if l.limit > 0 && l.decoded > l.limit {
+		n -= int(l.decoded - l.limit)
+		l.decoded = l.limit
+		return n, LimitError{PayloadBytes: true, Limit: l.limit}
+	}
+	return n, err
+}
+
+// A payloadLimitReader reads data from r up to the limit of payload
+type payloadLimitReader struct {
+	r       io.Reader
+	payload payloadLimit
+}
+
+func (l *payloadLimitReader) Read(p []byte) (n int, err error) {
+	return l.payload.count(l.r.Read(l.payload.shorten(p)))
+}
+
+// SetJobs sets the number of goroutines used to decode large reads.
+// The input of each read is split into pieces which are decoded concurrently.
+// If n is less than 2, reads are decoded without any extra goroutines.
+func (d *Decoder) SetJobs(n int) {
+	d.jobs = n
+}
+
+func (d *Decoder) Read(p []byte) (n int, err error) {
+	// one byte more than the limit is decoded
+	// to find out if there is more data
+	p = d.payload.shorten(p)
+
+	for {
+		if d.next != nil && len(d.out) == 0 {
+			d.nextFile()
+		}
+
+		n, err = d.readFile(p)
+		if n > 0 || err != nil || d.next == nil {
+			break
+		}
+	}
+
+	return d.payload.count(n, err)
 }
 
-func (d *customDecoder) Read(p []byte) (n int, err error) {
+// readFile reads the data of the current file
+func (d *Decoder) readFile(p []byte) (n int, err error) {
+	if d.enc == nil { // header hasn't been decoded yet
+		if d.opts.MaxFiles > 0 && d.files >= d.opts.MaxFiles {
+			return 0, LimitError{Files: true, Limit: int64(d.opts.MaxFiles)}
+		}
+
+		enc, end, err := decodeEncodingFromReader(d.r, d.opts.MaxScanBytes)
+		if err != nil {
+			return 0, moveError(err, d.nextPos.offset, d.nextPos.runeOffset)
+		}
+
+		d.enc, d.checksum = enc, enc.newChecksum()
+		d.bytesRead = d.nextPos.offset + end.offset
+		d.runeOffset = d.nextPos.runeOffset + end.runeOffset
+		d.files++
+	}
+
 	if len(p) == 0 {
 		return 0, nil
 	}
 
+	if len(d.out) == 0 && d.outErr == nil {
+		groupLen := d.enc.groupLen()
+		if len(p) >= groupLen {
+			return d.read(p)
+		}
+
+		// 5-bit and 6-bit encoding need room for a whole group,
+		// so decode into out and return it over several reads
+		out := d.group[:groupLen]
+		on, err := d.read(out)
+		d.out, d.outErr = out[:on], err
+	}
+
+	n = copy(p, d.out)
+	d.out = d.out[n:]
+	if len(d.out) == 0 {
+		err, d.outErr = d.outErr, nil
+	}
+	return n, err
+}
+
+func (d *Decoder) read(p []byte) (n int, err error) {
+	// position in the input of the start of src
+	base := position{d.bytesRead - len(d.buf), d.runeOffset}
+
 	srcLen := d.enc.encodedMinLen(len(p)) - len(d.buf)
 	// ensure that at least one byte will be read
 	if srcLen <= 0 {
 		srcLen = 1
 	}
 
-	src := make([]byte, srcLen)
-	si, readErr := d.r.Read(src)
+	// src is the buffered input followed by the new input
+	if cap(d.in) < len(d.buf)+srcLen {
+		d.in = make([]byte, len(d.buf)+srcLen)
+	}
+	src := d.in[:len(d.buf)+srcLen]
+	copy(src, d.buf)
+	si, readErr := d.r.Read(src[len(d.buf):])
+	if d.jobs > 1 && readErr == nil {
+		// fill src so the pieces of each goroutine are large
+		var k int
+		k, readErr = io.ReadFull(d.r, src[len(d.buf)+si:])
+		si += k
+		if readErr == io.ErrUnexpectedEOF {
+			readErr = io.EOF
+		}
+	}
+	d.bytesRead += si
 
 	if si == 0 {
 		if !d.delim && readErr == io.EOF {
-			return 0, CorruptPayloadError{NoDelimChar: true}
+			return 0, moveError(CorruptPayloadError{NoDelimChar: true}, base.offset, base.runeOffset)
 		} else {
 			return 0, readErr
 		}
 	}
 
-	// append new data to end of buffer and delete buffer
-	if d.buf != nil {
-		slices.Reverse(d.buf)
-		src = append(d.buf, src...)
-		si += len(d.buf)
-		d.buf = nil
-	}
+	si += len(d.buf)
+	d.buf = d.buf[:0]
 
-	// check if last character is complete and add to buffer if not
+	// check if last character is complete and buffer it if not
+	end := si
 	for r, _ := utf8.DecodeLastRune(src[:si]); r == utf8.RuneError; {
 		si--
 		if si < 0 {
+			d.buf = append(d.buf, src[:end]...)
 			return 0, nil
 		}
-		d.buf = append(d.buf, src[si])
 		r, _ = utf8.DecodeLastRune(src[:si])
 	}
 
+	// at returns err found at index i of src
+	at := func(err error, i int) error {
+		return moveError(errorAt(err, src, i), base.offset, base.runeOffset)
+	}
+	defer func() {
+		// the incomplete character follows any other buffered bytes
+		d.buf = append(d.buf, src[si:end]...)
+		// the bytes which aren't buffered again have been decoded
+		d.runeOffset += runeCount(src[:d.bytesRead-len(d.buf)-base.offset])
+	}()
+
 	// get index of delim character
-	di := strings.IndexRune(string(src[:si]), d.enc.delimChar)
+	di := bytes.IndexRune(src[:si], d.enc.delimChar)
+	if d.cat && d.delim {
+		// the next file may use the delim char of another profile
+		di = d.enc.indexSignature(src[:si])
+	}
 
 	if di > -1 {
-		if d.delim { // delim char already seen
-			return 0, CorruptPayloadError{UnexpectedDelimChar: true}
+		if d.delim && !d.cat { // delim char already seen
+			return 0, at(CorruptPayloadError{UnexpectedDelimChar: true}, di)
+		} else if d.delim { // the next file starts after the checksum
+			if !d.checked {
+				d.encodedChecksum = append(d.encodedChecksum, src[:di]...)
+				if err := d.decodeChecksum(); err != nil {
+					return 0, err
+				}
+			}
+			d.setNext(src[di:end], position{base.offset + di, base.runeOffset + runeCount(src[:di])})
+			return 0, nil
 		} else {
 			d.delim = true
+			ddi := di + utf8.RuneLen(d.enc.delimChar)
+			d.checksumPos = position{base.offset + ddi, base.runeOffset + utf8.RuneCount(src[:ddi])}
 		}
 	} else { // no delim char
 		di = si
@@ -826,17 +2290,20 @@ func (d *customDecoder) Read(p []byte) (n int, err error) {
 
 	if !d.delim || di != si { // src either contains only payload or payload + delim + checksum
 		var m int
-		n, m, err = d.enc.DecodePayload(p, src[:di])
+		if d.jobs > 1 && di >= d.jobs*chunkLen {
+			n, m, err = d.enc.decodeParallel(p, src[:di], di != si, d.jobs, &d.checksum)
+		} else {
+			n, m, err = d.enc.decodePayload(p, src[:di], di != si)
+			d.checksum.update(p[:n])
+		}
 
 		v, ok := err.(CorruptPayloadError)
 		if ok {
 			// buffer unread bytes
 			if v.IncompleteByte {
-				tmp := src[m:di]
-				slices.Reverse(tmp)
-				d.buf = append(d.buf, tmp...)
+				d.buf = append(d.buf, src[m:di]...)
 			} else {
-				return n, err
+				return n, moveError(err, base.offset, base.runeOffset)
 			}
 		} else if err != nil {
 			return n, err
@@ -844,14 +2311,23 @@ func (d *customDecoder) Read(p []byte) (n int, err error) {
 
 		if di != si { // delim char exists
 			ddi := di + utf8.RuneLen(d.enc.delimChar)
-			if ddi < si { // delim char is not the last character
-				d.encodedChecksum = append(d.encodedChecksum, src[ddi:si]...)
-				_, _, err = d.enc.DecodeChecksum(d.encodedChecksum)
+			if ddi < si && !d.checked { // delim char is not the last character
+				// the checksum ends at the start of the next file
+				ci := si
+				if d.cat {
+					if k := d.enc.indexSignature(src[ddi:si]); k >= 0 {
+						ci = ddi + k
+						d.setNext(src[ci:end], position{base.offset + ci, base.runeOffset + runeCount(src[:ci])})
+					}
+				}
+
+				d.encodedChecksum = append(d.encodedChecksum, src[ddi:ci]...)
+				err = d.decodeChecksum()
 
 				v, ok = err.(CorruptPayloadError)
 				if ok {
 					if v.ShortCRC {
-						if readErr == io.EOF {
+						if readErr == io.EOF || ci != si {
 							return n, err
 						}
 					} else {
@@ -862,9 +2338,10 @@ func (d *customDecoder) Read(p []byte) (n int, err error) {
 				}
 			}
 		}
-	} else { // src contains only checksum
+	} else if !d.checked { // src contains only checksum
+		// anything after the checksum, such as a terminator, is ignored
 		d.encodedChecksum = append(d.encodedChecksum, src[:si]...)
-		_, _, err = d.enc.DecodeChecksum(d.encodedChecksum)
+		err = d.decodeChecksum()
 
 		v, ok := err.(CorruptPayloadError)
 		if ok {
@@ -881,29 +2358,224 @@ func (d *customDecoder) Read(p []byte) (n int, err error) {
 	}
 
 	if !d.delim && readErr == io.EOF {
-		return n, CorruptPayloadError{NoDelimChar: true}
+		return n, at(CorruptPayloadError{NoDelimChar: true}, si)
 	}
 
+	if d.next != nil { // the rest of the input is read for the next file
+		return n, nil
+	}
 	return n, readErr
 }
 
-type catDecoder struct {
-	enc             *Encoding
-	r               io.Reader
-	checksum        bool
-	encodedChecksum []byte
+// indexSignature returns the index of the first character in src
+// which can start a file using a built-in profile, or -1 if there is none.
+// The characters of the table of enc aren't counted,
+// so the checksum isn't mistaken for the next file.
+func (enc *Encoding) indexSignature(src []byte) int {
+	i := -1
+	for _, c := range delimChars {
+		if _, ok := enc.decodeMap.lookup(c); ok {
+			continue
+		}
+		if k := bytes.IndexRune(src, c); k >= 0 {
+			i, src = k, src[:k]
+		}
+	}
+	return i
+}
+
+// setNext saves the input from the start of the next file,
+// which is at pos
+func (d *Decoder) setNext(next []byte, pos position) {
+	d.next = append([]byte(nil), next...)
+	d.nextPos = pos
+}
+
+// nextFile prepares d to decode the next file,
+// whose input starts with next and continues with the rest of r
+func (d *Decoder) nextFile() {
+	if pr, ok := d.r.(*prefixReader); ok {
+		pr.prefix = append(d.next, pr.prefix...)
+	} else {
+		d.r = &prefixReader{d.next, d.r}
+	}
+
+	d.enc, d.next = nil, nil
+	d.buf, d.encodedChecksum = d.buf[:0], d.encodedChecksum[:0]
+	d.delim, d.checked, d.outErr = false, false, nil
+}
+
+// A prefixReader reads prefix and then r
+type prefixReader struct {
+	prefix []byte
+	r      io.Reader
+}
+
+func (pr *prefixReader) Read(p []byte) (n int, err error) {
+	if len(pr.prefix) > 0 {
+		n = copy(p, pr.prefix)
+		pr.prefix = pr.prefix[n:]
+		return n, nil
+	}
+	return pr.r.Read(p)
+}
+
+// WriteTo writes the decoded data to w until the end of the file
+// and returns the number of bytes written
+func (d *Decoder) WriteTo(w io.Writer) (n int64, err error) {
+	// each goroutine decodes parallelLen bytes
+	size := chunkLen
+	if d.jobs > 1 {
+		size = d.jobs * parallelLen
+	}
+	if len(d.outBuf) != size {
+		d.outBuf = make([]byte, size)
+	}
+	return writeTo(w, d, d.outBuf)
+}
+
+// decodeChecksum decodes the checksum read so far
+// and compares it with the checksum of the payload
+func (d *Decoder) decodeChecksum() error {
+	d.crc = d.checksum.crc()
+	_, _, err := d.enc.DecodeChecksum(d.encodedChecksum, d.crc)
+	d.checked = err == nil
+	return moveError(err, d.checksumPos.offset, d.checksumPos.runeOffset)
+}
+
+// Checksum returns the checksum of the decoded payload.
+// It is only valid once the whole file has been read.
+func (d *Decoder) Checksum() uint64 {
+	return d.crc
+}
+
+type rawEncoder struct {
+	payloadWriter
+}
+
+// NewRawEncoder creates an encoder which
+// writes only the encoded payload to w.
+// There is no file signature, header, delim, or checksum,
+// so the checksum type of enc is ignored.
+// Close must be called to write the end of a 5-bit or 6-bit payload.
+func NewRawEncoder(enc *Encoding, w io.Writer) io.WriteCloser {
+	return &rawEncoder{payloadWriter{enc: enc, w: w}}
+}
+
+func (e *rawEncoder) Write(p []byte) (n int, err error) {
+	if err := e.writePayload(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *rawEncoder) Close() error {
+	return e.closePayload()
+}
+
+type rawDecoder struct {
+	enc    *Encoding
+	r      io.Reader
+	buf    []byte // input which hasn't been decoded yet
+	in     []byte // buffer for reading from r
+	out    []byte // decoded data which hasn't been returned yet
+	outBuf []byte   // buffer for out
+	err    error    // error from r or the decoding error
+	pos    position // position of buf in the input
+}
+
+// NewRawDecoder creates a decoder which
+// decodes a payload written by a raw encoder.
+// Any characters in r which are not in the table of enc are ignored,
+// so r may contain a message.
+// The encoding type of enc must match the one used to encode the payload
+// because there is no header to read it from.
+func NewRawDecoder(enc *Encoding, r io.Reader) io.Reader {
+	return &rawDecoder{enc: enc, r: r}
+}
+
+func (d *rawDecoder) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for len(d.out) == 0 {
+		if d.err != nil {
+			if d.err == io.EOF && len(d.buf) != 0 {
+				// the remaining input is the end of the payload
+				dst := d.buffer(d.enc.DecodedPayloadMaxLen(len(d.buf)))
+				dn, _, err := d.enc.decodePayload(dst, d.buf, true)
+				if err != nil {
+					d.err = moveError(err, d.pos.offset, d.pos.runeOffset)
+				}
+				d.out = dst[:dn]
+				d.buf = nil
+				continue
+			}
+			return 0, d.err
+		}
+
+		if d.in == nil {
+			d.in = make([]byte, 4096)
+		}
+		si, readErr := d.r.Read(d.in)
+		d.buf = append(d.buf, d.in[:si]...)
+		d.err = readErr
+
+		// leave incomplete characters in the buffer
+		end := len(d.buf)
+		if d.err == nil {
+			for start := end - 1; start >= 0 && start > end-utf8.UTFMax; start-- {
+				if utf8.RuneStart(d.buf[start]) {
+					if !utf8.FullRune(d.buf[start:]) {
+						end = start
+					}
+					break
+				}
+			}
+		}
+
+		// an incomplete byte is decoded once the rest of it is read,
+		// but other errors are returned after the data before them
+		dst := d.buffer(d.enc.DecodedPayloadMaxLen(end))
+		dn, m, err := d.enc.decodePayload(dst, d.buf[:end], false)
+		if v, ok := err.(CorruptPayloadError); ok && !v.IncompleteByte {
+			d.err = moveError(err, d.pos.offset, d.pos.runeOffset)
+		}
+		d.out = dst[:dn]
+		d.pos.offset += m
+		d.pos.runeOffset += runeCount(d.buf[:m])
+		d.buf = append(d.buf[:0], d.buf[m:]...)
+	}
+
+	n = copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
 }
 
-func NewCatDecoder(r io.Reader) io.Reader {
-	return &catDecoder{r: r}
+// buffer returns a buffer of n bytes for out,
+// which is only valid until out has been returned
+func (d *rawDecoder) buffer(n int) []byte {
+	if cap(d.outBuf) < n {
+		d.outBuf = make([]byte, n)
+	}
+	return d.outBuf[:n]
 }
 
-func (d *catDecoder) Read(p []byte) (n int, err error) {
-	return 0, nil
+// NewCatDecoder creates a Decoder for several ZWC files one after another,
+// which returns the data of every file.
+// The header of each file is decoded like NewDecoder
+// and the checksum of each file must match.
+// Anything between the files, such as a message, is discarded.
+func NewCatDecoder(r io.Reader) *Decoder {
+	d := NewDecoder(r)
+	d.cat = true
+	return d
 }
 
-func (enc *Encoding) Checksum() uint64 {
-	return enc.crc
+// Checksum returns the checksum written by the last call to Close
+func (e *Encoder) Checksum() uint64 {
+	return e.crc
 }
 
 // CRC2 takes an augmented message
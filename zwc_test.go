@@ -17,10 +17,16 @@
 package zwc_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"unicode/utf8"
 
 	"github.com/yadayadajaychan/zwc"
 	"github.com/snksoft/crc"
@@ -262,13 +268,8 @@ func TestEncodeChecksum(t *testing.T) {
 	for _, tc := range testCases {
 		enc := zwc.NewEncoding(tc.version, tc.encodingType, tc.checksumType)
 
-		n := enc.EncodePayload(nil, tc.data)
-		if n != 0 {
-			t.Errorf("Expected %v, got %v", 0, n)
-		}
-
 		dst := make([]byte, enc.EncodedChecksumMaxLen())
-		n = enc.EncodeChecksum(dst)
+		n := enc.EncodeChecksum(dst, enc.CRC(tc.data))
 
 		if n != len(tc.expected) {
 			t.Errorf("Expected %v, got %v", len(tc.expected), n)
@@ -347,7 +348,7 @@ func TestDecodeChecksum(t *testing.T) {
 			t.Errorf("Expected %q, got %q", tc.data, dst[:n])
 		}
 
-		checksum, m, err := enc.DecodeChecksum([]byte(tc.encodedChecksum))
+		checksum, m, err := enc.DecodeChecksum([]byte(tc.encodedChecksum), enc.CRC(dst[:n]))
 		if err != nil {
 			t.Error("DecodeChecksum returned an error of", err)
 		}
@@ -357,16 +358,22 @@ func TestDecodeChecksum(t *testing.T) {
 		if checksum != tc.expectedChecksum {
 			t.Errorf("Expected %v, got %v", tc.expectedChecksum, checksum)
 		}
-		if enc.Checksum() != tc.expectedChecksum {
-			t.Errorf("Expected %v, got %v", tc.expectedChecksum, enc.Checksum())
+		if enc.CRC(tc.data) != tc.expectedChecksum {
+			t.Errorf("Expected %v, got %v", tc.expectedChecksum, enc.CRC(tc.data))
+		}
+
+		// a checksum which doesn't match the payload
+		_, _, err = enc.DecodeChecksum([]byte(tc.encodedChecksum), tc.expectedChecksum+1)
+		if v, ok := err.(zwc.CorruptPayloadError); tc.checksumType != 0 && (!ok || !v.CRCFail) {
+			t.Error("Expected CRCFail, got", err)
 		}
 	}
 }
 
 // TestEncodeAndEncoderAndDecodeAndDecoder tests the Encode method of Encoding,
-// the Write and Close methods of encoder,
+// the Write and Close methods of Encoder,
 // the Decode method of Encoding,
-// and the Read method of decoder and customDecoder
+// and the Read method of Decoder
 func TestEncodeAndEncoderAndDecodeAndDecoder(t *testing.T) {
 	testCases := []struct {
 		version		int
@@ -510,7 +517,7 @@ func TestEncodeAndEncoderAndDecodeAndDecoder(t *testing.T) {
 		}
 	}
 
-	// Write and Close methods of encoder
+	// Write and Close methods of Encoder
 	for _, tc := range testCases {
 		var b bytes.Buffer
 		enc := zwc.NewEncoding(tc.version, tc.encodingType, tc.checksumType)
@@ -529,7 +536,7 @@ func TestEncodeAndEncoderAndDecodeAndDecoder(t *testing.T) {
 		}
 	}
 
-	// Write and Close methods of encoder
+	// Write and Close methods of Encoder
 	// same as above but
 	// each byte is written one by one
 	for _, tc := range testCases {
@@ -581,7 +588,7 @@ func TestEncodeAndEncoderAndDecodeAndDecoder(t *testing.T) {
 		}
 	}
 
-	// Read method of customDecoder with 1 byte slice
+	// Read method of Decoder from NewCustomDecoder with 1 byte slice
 	for i, tc := range testCases {
 		delimChar := string(zwc.V1DelimCharUTF8)
 		encoded := strings.Split(tc.expected, delimChar)
@@ -618,7 +625,7 @@ func TestEncodeAndEncoderAndDecodeAndDecoder(t *testing.T) {
 		}
 	}
 
-	// Read method of customDecoder with 2 byte slice
+	// Read method of Decoder from NewCustomDecoder with 2 byte slice
 	for i, tc := range testCases {
 		delimChar := string(zwc.V1DelimCharUTF8)
 		encoded := strings.Split(tc.expected, delimChar)
@@ -655,7 +662,7 @@ func TestEncodeAndEncoderAndDecodeAndDecoder(t *testing.T) {
 		}
 	}
 
-	// Read method of decoder with 1 byte slice
+	// Read method of Decoder from NewDecoder with 1 byte slice
 	for i, tc := range testCases {
 		r := bytes.NewBufferString(tc.expected)
 		d := zwc.NewDecoder(r)
@@ -684,7 +691,7 @@ func TestEncodeAndEncoderAndDecodeAndDecoder(t *testing.T) {
 		}
 	}
 
-	// Read method of decoder with 2 byte slice
+	// Read method of Decoder from NewDecoder with 2 byte slice
 	for i, tc := range testCases {
 		r := bytes.NewBufferString(tc.expected)
 		d := zwc.NewDecoder(r)
@@ -715,7 +722,7 @@ func TestEncodeAndEncoderAndDecodeAndDecoder(t *testing.T) {
 }
 
 // TestEncoderNumberOfBytesWritten tests that
-// the number of bytes returned by encoder.Write
+// the number of bytes returned by Encoder.Write
 // is the same as the input data
 func TestEncoderNumberOfBytesWritten(t *testing.T) {
 	testCases := []struct {
@@ -745,6 +752,1243 @@ func TestEncoderNumberOfBytesWritten(t *testing.T) {
 	}
 }
 
+// TestSharedEncoding tests that one Encoding can be shared
+// by Encoders and Decoders in several goroutines
+func TestSharedEncoding(t *testing.T) {
+	enc := zwc.NewEncoding(1, 3, 32)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			data := bytes.Repeat([]byte{byte(i)}, 1000+i)
+			var b bytes.Buffer
+			e := zwc.NewEncoder(enc, &b)
+			for j := 0; j < len(data); j += 100 {
+				end := j + 100
+				if end > len(data) {
+					end = len(data)
+				}
+				e.Write(data[j:end])
+			}
+			if err := e.Close(); err != nil {
+				t.Error("Close returned an error of", err)
+				return
+			}
+			if e.Checksum() != enc.CRC(data) {
+				t.Errorf("goroutine %v: Expected %x, got %x", i, enc.CRC(data), e.Checksum())
+			}
+
+			if _, err := zwc.DecodeEncodingFromReader(&b); err != nil {
+				t.Error("DecodeEncodingFromReader returned an error of", err)
+				return
+			}
+			d := zwc.NewCustomDecoder(enc, iotest.OneByteReader(&b))
+			decoded, err := io.ReadAll(d)
+			if err != nil {
+				t.Errorf("goroutine %v: ReadAll returned an error of %v", i, err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Errorf("goroutine %v: decoded data doesn't match", i)
+			}
+			if d.Checksum() != enc.CRC(data) {
+				t.Errorf("goroutine %v: Expected %x, got %x", i, enc.CRC(data), d.Checksum())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// TestAppendEncodeAndAppendDecode tests the one-shot functions
+// which encode and decode a whole ZWC file
+func TestAppendEncodeAndAppendDecode(t *testing.T) {
+	encodings := []*zwc.Encoding{
+		zwc.NewEncoding(1, 2, 8),
+		zwc.NewEncoding(1, 3, 16),
+		zwc.NewEncoding(1, 4, 32),
+		zwc.NewEncoding(2, 5, 0),
+		zwc.NewEncoding(2, 6, 16),
+		zwc.NewBidiSafeEncoding(4, 32),
+		zwc.NewBidiSafeEncoding(3, 8),
+		zwc.NewVariationSelectorEncoding(16),
+		zwc.NewTagEncoding(32),
+	}
+	data := [][]byte{
+		[]byte(""),
+		[]byte("a"),
+		[]byte("hello, world!"),
+		bytes.Repeat([]byte("\x00\xff\x80zwc"), 100),
+	}
+
+	for i, enc := range encodings {
+		for j, d := range data {
+			encoded := enc.EncodeToString(d)
+			if n := enc.EncodedLen(len(d)); n != len(encoded) && n != -1 {
+				t.Errorf("testcase %d,%d: EncodedLen returned %d, expected %d", i, j, n, len(encoded))
+			}
+			if n := enc.DecodedLen(len(encoded)); n != len(d) && n != -1 {
+				t.Errorf("testcase %d,%d: DecodedLen returned %d, expected %d", i, j, n, len(d))
+			}
+
+			prefix := []byte("prefix")
+			appended := enc.AppendEncode(prefix, d)
+			if string(appended) != "prefix"+encoded {
+				t.Errorf("testcase %d,%d: AppendEncode didn't append to dst", i, j)
+			}
+
+			decoded, err := zwc.DecodeString("text" + encoded)
+			if err != nil {
+				t.Errorf("testcase %d,%d: DecodeString returned an error of %v", i, j, err)
+			} else if !bytes.Equal(decoded, d) {
+				t.Errorf("testcase %d,%d: Expected %q, got %q", i, j, d, decoded)
+			}
+
+			decoded, err = zwc.AppendDecode(prefix, []byte(encoded))
+			if err != nil || string(decoded) != "prefix"+string(d) {
+				t.Errorf("testcase %d,%d: AppendDecode returned %q, %v", i, j, decoded, err)
+			}
+		}
+	}
+
+	// errors are offset by the position of the payload in src
+	enc := zwc.NewEncoding(1, 2, 16)
+	encoded := enc.AppendEncode([]byte("ab"), []byte("hello"))
+	delim := enc.DelimCharAsUTF8()
+	noDelim := encoded[:bytes.LastIndex(encoded, delim)]
+	_, err := zwc.AppendDecode(nil, noDelim)
+	var v zwc.CorruptPayloadError
+	if !errors.Is(err, zwc.ErrMissingDelim) || !errors.As(err, &v) || v.Offset != len(noDelim) {
+		t.Error("AppendDecode: Expected missing delim at", len(noDelim), "got", err)
+	}
+
+	// the lengths are only known if every character has the same length
+	testCases := []struct {
+		enc   *zwc.Encoding
+		exact bool
+	}{
+		{zwc.NewEncoding(1, 2, 8), true},
+		{zwc.NewEncoding(1, 3, 32), true},
+		{zwc.NewEncoding(1, 4, 16), false},
+		{zwc.NewEncoding(2, 5, 16), false},
+		{zwc.NewEncoding(2, 6, 16), true},
+		{zwc.NewVariationSelectorEncoding(8), false},
+	}
+	for i, tc := range testCases {
+		if exact := tc.enc.EncodedLen(10) != -1; exact != tc.exact {
+			t.Errorf("testcase %v: Expected exact EncodedLen %v, got %v", i, tc.exact, exact)
+		}
+		if exact := tc.enc.DecodedLen(100) != -1; exact != tc.exact {
+			t.Errorf("testcase %v: Expected exact DecodedLen %v, got %v", i, tc.exact, exact)
+		}
+	}
+
+	if _, err := zwc.DecodeString("no file"); err != io.EOF {
+		t.Error("Expected EOF, got", err)
+	}
+}
+
+func TestReadFromAndWriteTo(t *testing.T) {
+	data := bytes.Repeat([]byte("hello, world! "), 10000)
+
+	for _, enc := range []*zwc.Encoding{
+		zwc.NewEncoding(1, 3, 16),
+		zwc.NewEncoding(2, 5, 32),
+		zwc.NewTagEncoding(8),
+	} {
+		var encoded bytes.Buffer
+		encoder := zwc.NewEncoder(enc, &encoded)
+		n, err := encoder.ReadFrom(iotest.HalfReader(bytes.NewReader(data)))
+		if err != nil || n != int64(len(data)) {
+			t.Fatal("ReadFrom returned", n, err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(encoded.Bytes(), enc.AppendEncode(nil, data)) {
+			t.Error("ReadFrom and AppendEncode don't match")
+		}
+
+		var decoded bytes.Buffer
+		n, err = zwc.NewDecoder(iotest.HalfReader(&encoded)).WriteTo(&decoded)
+		if err != nil || n != int64(len(data)) {
+			t.Fatal("WriteTo returned", n, err)
+		}
+		if !bytes.Equal(decoded.Bytes(), data) {
+			t.Error("WriteTo didn't write the data")
+		}
+	}
+
+	// errors are returned by WriteTo
+	enc := zwc.NewEncoding(1, 2, 16)
+	encoded := enc.AppendEncode(nil, []byte("hello"))
+	i := bytes.LastIndex(encoded, enc.DelimCharAsUTF8())
+	_, err := zwc.NewDecoder(bytes.NewReader(encoded[:i])).WriteTo(io.Discard)
+	if !errors.Is(err, zwc.ErrMissingDelim) {
+		t.Error("Expected missing delim, got", err)
+	}
+}
+
+func TestParallelEncoderAndDecoder(t *testing.T) {
+	// odd length so the last group is incomplete
+	data := append(benchmarkData(), "end"...)
+
+	for _, enc := range []*zwc.Encoding{
+		zwc.NewEncoding(1, 2, 8),
+		zwc.NewEncoding(1, 3, 16),
+		zwc.NewEncoding(2, 5, 32),
+		zwc.NewEncoding(2, 6, 16),
+		zwc.NewEncoding(2, zwc.RadixEncoding, 32),
+		zwc.NewEncoding(2, 8, 0),
+		zwc.NewVariationSelectorEncoding(32),
+		zwc.NewTagEncoding(16),
+	} {
+		want := enc.AppendEncode(nil, data)
+
+		// the first write leaves a pending group
+		var encoded bytes.Buffer
+		encoder := zwc.NewEncoder(enc, &encoded)
+		encoder.SetJobs(4)
+		if _, err := encoder.Write(data[:1]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := encoder.ReadFrom(bytes.NewReader(data[1:])); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded.Bytes(), want) {
+			t.Error(enc.EncodingType(), ": parallel Encoder and AppendEncode don't match")
+		}
+		if encoder.Checksum() != enc.CRC(data) {
+			t.Error(enc.EncodingType(), ": parallel Encoder checksum is", encoder.Checksum())
+		}
+
+		// characters which aren't in the table are in the payload
+		var text []byte
+		for i := 0; i < len(want); {
+			j := i + 9999
+			for j < len(want) && !utf8.RuneStart(want[j]) {
+				j++
+			}
+			if j > len(want)-1000 {
+				j = len(want)
+			}
+			text = append(text, want[i:j]...)
+			if j < len(want) {
+				text = append(text, "message"...)
+			}
+			i = j
+		}
+
+		decoder := zwc.NewDecoder(iotest.HalfReader(bytes.NewReader(text)))
+		decoder.SetJobs(4)
+		var decoded bytes.Buffer
+		if _, err := decoder.WriteTo(&decoded); err != nil {
+			t.Fatal(enc.EncodingType(), ": parallel Decoder returned", err)
+		}
+		if !bytes.Equal(decoded.Bytes(), data) {
+			t.Error(enc.EncodingType(), ": parallel Decoder didn't decode the data")
+		}
+		if decoder.Checksum() != enc.CRC(data) {
+			t.Error(enc.EncodingType(), ": parallel Decoder checksum is", decoder.Checksum())
+		}
+	}
+
+	// errors are the same as without goroutines
+	enc := zwc.NewEncoding(1, 3, 16)
+	encoded := enc.AppendEncode(nil, data)
+	for _, corrupt := range []func([]byte) []byte{
+		// a checksum which doesn't match
+		func(b []byte) []byte {
+			i := bytes.LastIndex(b, enc.DelimCharAsUTF8()) + len(enc.DelimCharAsUTF8())
+			sum := make([]byte, enc.EncodedChecksumMaxLen())
+			n := enc.EncodeChecksum(sum, enc.CRC(data)+1)
+			return append(b[:i], sum[:n]...)
+		},
+		// a corrupt character in the middle of the payload
+		func(b []byte) []byte {
+			b[len(b)/2] = 0xff
+			return b
+		},
+	} {
+		text := corrupt(bytes.Clone(encoded))
+		_, serialErr := zwc.NewDecoder(bytes.NewReader(text)).WriteTo(io.Discard)
+		decoder := zwc.NewDecoder(bytes.NewReader(text))
+		decoder.SetJobs(4)
+		_, err := decoder.WriteTo(io.Discard)
+		if err == nil || serialErr == nil || err.Error() != serialErr.Error() {
+			t.Error("Expected", serialErr, "got", err)
+		}
+	}
+}
+
+func TestDecodeRange(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	ranges := []struct {
+		off, n int
+	}{
+		{0, 10},
+		{7, 100},
+		{333, 1},
+		{0, 1000},
+		{500, 0},
+		{995, 10},
+		{1000, 5},
+		{2000, 1},
+	}
+
+	for _, enc := range []*zwc.Encoding{
+		zwc.NewEncoding(1, 2, 8),
+		zwc.NewEncoding(1, 3, 16),
+		zwc.NewEncoding(1, 4, 32),
+		zwc.NewEncoding(2, 5, 32),
+		zwc.NewEncoding(2, 6, 16),
+		zwc.NewEncoding(2, zwc.RadixEncoding, 32),
+		zwc.NewVariationSelectorEncoding(32),
+		zwc.NewTagEncoding(16),
+	} {
+		// data + delim + checksum
+		src := make([]byte, enc.EncodedPayloadMaxLen(len(data)))
+		src = src[:enc.EncodePayload(src, data)]
+		src = append(src, enc.DelimCharAsUTF8()...)
+		checksum := make([]byte, enc.EncodedChecksumMaxLen())
+		src = append(src, checksum[:enc.EncodeChecksum(checksum, enc.CRC(data))]...)
+
+		index, err := enc.NewRangeIndex(src)
+		if err != nil {
+			t.Error(enc.EncodingType(), ": NewRangeIndex returned an error of", err)
+			continue
+		}
+
+		for _, r := range ranges {
+			start, end := r.off, r.off+r.n
+			if start > len(data) {
+				start = len(data)
+			}
+			if end > len(data) {
+				end = len(data)
+			}
+
+			got, err := enc.DecodeRange(src, r.off, r.n)
+			gotReader, errReader := enc.DecodeRangeFromReader(iotest.HalfReader(bytes.NewReader(src)), r.off, r.n)
+			gotIndex, errIndex := index.DecodeRange(r.off, r.n)
+			for name, got := range map[string][]byte{"DecodeRange": got,
+				"DecodeRangeFromReader": gotReader, "RangeIndex": gotIndex} {
+				if !bytes.Equal(got, data[start:end]) {
+					t.Error(name, enc.EncodingType(), ": range", r.off, r.n, ": expected", data[start:end], "got", got)
+				}
+			}
+			for name, err := range map[string]error{"DecodeRange": err,
+				"DecodeRangeFromReader": errReader, "RangeIndex": errIndex} {
+				if r.off+r.n > len(data) && err != io.EOF {
+					t.Error(name, enc.EncodingType(), ": range", r.off, r.n, ": expected EOF, got", err)
+				} else if r.off+r.n <= len(data) && err != nil {
+					t.Error(name, enc.EncodingType(), ": range", r.off, r.n, ":", err)
+				}
+			}
+		}
+
+		if _, err := enc.DecodeRange(src[:len(src)/2], 0, len(data)); !errors.Is(err, zwc.ErrMissingDelim) {
+			t.Error(enc.EncodingType(), ": expected missing delim, got", err)
+		}
+		if _, err := enc.NewRangeIndex(src[:len(src)/2]); !errors.Is(err, zwc.ErrMissingDelim) {
+			t.Error(enc.EncodingType(), ": expected missing delim, got", err)
+		}
+		_, err = enc.DecodeRangeFromReader(bytes.NewReader(src[:len(src)/2]), 0, len(data))
+		var v zwc.CorruptPayloadError
+		if !errors.As(err, &v) || !v.NoDelimChar || v.Offset != len(src)/2 {
+			t.Error(enc.EncodingType(), ": expected missing delim at", len(src)/2, "got", err)
+		}
+	}
+
+	// characters which aren't in the table are counted
+	// if the characters of the table have different lengths
+	enc := zwc.NewEncoding(1, 4, 16)
+	encoded := enc.AppendEncode(nil, data)
+	delim := enc.DelimCharAsUTF8()
+	i := bytes.Index(encoded[len(delim):], delim) + 2*len(delim) // end of the header
+	j := i + 300
+	for !utf8.RuneStart(encoded[j]) {
+		j++
+	}
+	src := append([]byte("message "), encoded[i:j]...)
+	src = append(src, " message "...)
+	src = append(src, encoded[j:]...)
+	got, err := enc.DecodeRange(src, 100, 200)
+	if err != nil || !bytes.Equal(got, data[100:300]) {
+		t.Error("DecodeRange returned", got, err)
+	}
+	got, err = enc.DecodeRangeFromReader(bytes.NewReader(src), 100, 200)
+	if err != nil || !bytes.Equal(got, data[100:300]) {
+		t.Error("DecodeRangeFromReader returned", got, err)
+	}
+	index, err := enc.NewRangeIndex(src)
+	if err != nil {
+		t.Fatal("NewRangeIndex returned an error of", err)
+	}
+	got, err = index.DecodeRange(100, 200)
+	if err != nil || !bytes.Equal(got, data[100:300]) {
+		t.Error("RangeIndex returned", got, err)
+	}
+
+	// the recorded positions are used for ranges after the first 256 groups
+	data = make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+	src = enc.AppendEncode(nil, data)[i:]
+	index, err = enc.NewRangeIndex(src)
+	if err != nil {
+		t.Fatal("NewRangeIndex returned an error of", err)
+	}
+	for _, off := range []int{0, 255, 256, 700, 2999} {
+		got, err = index.DecodeRange(off, 300)
+		end := off + 300
+		if end > len(data) {
+			end = len(data)
+		}
+		expected := data[off:end]
+		if !bytes.Equal(got, expected) || (off+300 > len(data)) != (err == io.EOF) {
+			t.Error("RangeIndex", off, ": expected", expected, "got", got, err)
+		}
+	}
+
+	// a corrupt range is reported at its offset in src
+	corrupt := enc.EncodePayload(make([]byte, enc.EncodedPayloadMaxLen(700)), data[:700])
+	src[corrupt] = 0xFF
+	_, err = index.DecodeRange(700, 1)
+	var v zwc.CorruptPayloadError
+	if !errors.As(err, &v) || v.Offset != corrupt {
+		t.Error("Expected error at", corrupt, "got", err)
+	}
+}
+
+func TestCatDecoder(t *testing.T) {
+	files := []struct {
+		enc  *zwc.Encoding
+		data []byte
+	}{
+		{zwc.NewEncoding(1, 3, 16), []byte("first file")},
+		{zwc.NewEncoding(2, 5, 32), bytes.Repeat([]byte("second file "), 5000)},
+		{zwc.NewTagEncoding(8), []byte("third")},
+	}
+
+	var text, data []byte
+	for _, f := range files {
+		text = append(text, "message "...)
+		text = f.enc.AppendEncode(text, f.data)
+		data = append(data, f.data...)
+	}
+	text = append(text, " end of message"...)
+
+	for _, r := range []func() io.Reader{
+		func() io.Reader { return bytes.NewReader(text) },
+		func() io.Reader { return iotest.OneByteReader(bytes.NewReader(text)) },
+		func() io.Reader { return iotest.HalfReader(bytes.NewReader(text)) },
+	} {
+		got, err := io.ReadAll(zwc.NewCatDecoder(r()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Error("NewCatDecoder didn't decode every file")
+		}
+
+		// only one file is decoded by NewDecoder
+		got, err = io.ReadAll(zwc.NewDecoder(r()))
+		if err == nil && !bytes.Equal(got, files[0].data) {
+			t.Error("NewDecoder decoded", got)
+		}
+	}
+
+	// the checksum of every file is checked
+	// flip a bit of the last payload character of the second file
+	corrupt := bytes.Clone(text)
+	second := len("message ") + len(files[0].enc.AppendEncode(nil, files[0].data)) + len("message ")
+	end := second + len(files[1].enc.AppendEncode(nil, files[1].data))
+	corrupt[bytes.LastIndex(corrupt[:end], files[1].enc.DelimCharAsUTF8())-1] ^= 1
+	_, err := io.ReadAll(zwc.NewCatDecoder(bytes.NewReader(corrupt)))
+	var v zwc.CorruptPayloadError
+	if !errors.As(err, &v) || v.Offset < second {
+		t.Error("Expected an error in the second file, got", err)
+	}
+}
+
+func TestDecoderOptions(t *testing.T) {
+	enc := zwc.NewEncoding(2, 5, 16)
+	data := bytes.Repeat([]byte("data "), 200)
+	text := append([]byte("message "), enc.AppendEncode(nil, data)...)
+
+	decode := func(r io.Reader, opts zwc.DecoderOptions) ([]byte, error) {
+		d := zwc.NewCatDecoder(r)
+		d.SetOptions(opts)
+		return io.ReadAll(d)
+	}
+
+	// every limit is at least the amount needed
+	_, err := decode(bytes.NewReader(text), zwc.DecoderOptions{
+		MaxPayloadBytes: int64(len(data)),
+		MaxScanBytes:    int64(len("message ") + 1),
+		MaxFiles:        1,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	check := func(name string, err error, sentinel error, limit int64) {
+		var v zwc.LimitError
+		if !errors.Is(err, zwc.ErrLimit) || !errors.Is(err, sentinel) || !errors.As(err, &v) {
+			t.Error(name, ": Expected", sentinel, "got", err)
+		} else if v.Limit != limit {
+			t.Error(name, ": Expected limit", limit, "got", v.Limit)
+		}
+	}
+
+	// the data up to the limit is returned,
+	// even if it is read a byte at a time
+	for _, size := range []int{1, 512} {
+		d := zwc.NewDecoder(bytes.NewReader(text))
+		d.SetOptions(zwc.DecoderOptions{MaxPayloadBytes: 999})
+		var got []byte
+		p := make([]byte, size)
+		for {
+			n, err := d.Read(p)
+			got = append(got, p[:n]...)
+			if err != nil {
+				check("payload", err, zwc.ErrMaxPayloadBytes, 999)
+				break
+			}
+		}
+		if !bytes.Equal(got, data[:999]) {
+			t.Error("payload: Expected the first 999 bytes, got", len(got))
+		}
+	}
+
+	// the signature must start within the limit
+	_, err = decode(bytes.NewReader(text), zwc.DecoderOptions{MaxScanBytes: int64(len("message "))})
+	check("scan", err, zwc.ErrMaxScanBytes, int64(len("message ")))
+	_, err = decode(bytes.NewReader([]byte("no file")), zwc.DecoderOptions{MaxScanBytes: 1000})
+	if err != io.EOF && err != nil {
+		t.Error("scan: Expected EOF, got", err)
+	}
+
+	// the data of the files within the limit is returned
+	got, err := decode(bytes.NewReader(bytes.Repeat(text, 3)), zwc.DecoderOptions{MaxFiles: 2})
+	check("files", err, zwc.ErrMaxFiles, 2)
+	if !bytes.Equal(got, bytes.Repeat(data, 2)) {
+		t.Error("files: Expected the data of two files, got", len(got))
+	}
+
+	// readers without options are limited the same way
+	var payload bytes.Buffer
+	w := zwc.NewRawEncoder(enc, &payload)
+	w.Write(data)
+	w.Close()
+	raw := zwc.NewRawDecoder(enc, &payload)
+	got, err = io.ReadAll(zwc.DecoderOptions{MaxPayloadBytes: 999}.LimitPayload(raw))
+	check("raw", err, zwc.ErrMaxPayloadBytes, 999)
+	if !bytes.Equal(got, data[:999]) {
+		t.Error("raw: Expected the first 999 bytes, got", len(got))
+	}
+
+	// headers decoded before the payload use the scan limit
+	opts := zwc.DecoderOptions{MaxScanBytes: int64(len("message "))}
+	_, err = opts.DecodeEncodingFromReader(bytes.NewReader(text))
+	check("header", err, zwc.ErrMaxScanBytes, int64(len("message ")))
+	_, _, _, err = opts.DecodeCustomHeaderFromReader(zwc.V1Table[:], zwc.V1DelimChar, bytes.NewReader(text))
+	check("custom header", err, zwc.ErrMaxScanBytes, int64(len("message ")))
+	opts.MaxScanBytes++
+	if _, err := opts.DecodeEncodingFromReader(bytes.NewReader(text)); err != nil {
+		t.Error("header:", err)
+	}
+
+	// text which is read all at once must be within the scan limit
+	_, err = zwc.DecoderOptions{MaxScanBytes: int64(len(text) - 1)}.ReadText(bytes.NewReader(text))
+	check("text", err, zwc.ErrMaxScanBytes, int64(len(text)-1))
+	if got, err := (zwc.DecoderOptions{MaxScanBytes: int64(len(text))}).ReadText(bytes.NewReader(text)); err != nil || !bytes.Equal(got, text) {
+		t.Error("text: Expected the whole text, got", len(got), err)
+	}
+
+	// carriers read the whole text, so it must be within the scan limit
+	hidden, err := zwc.SpaceCarrier.Encode(zwc.NewEncoding(1, 2, 8),
+		bytes.Repeat([]byte("a b "), 400), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = zwc.DecoderOptions{MaxScanBytes: int64(len(hidden) - 1)}.DecodeCarrier(zwc.SpaceCarrier, bytes.NewReader(hidden))
+	check("carrier scan", err, zwc.ErrMaxScanBytes, int64(len(hidden)-1))
+	_, _, err = zwc.DecoderOptions{MaxPayloadBytes: 3}.DecodeCarrier(zwc.SpaceCarrier, bytes.NewReader(hidden))
+	check("carrier payload", err, zwc.ErrMaxPayloadBytes, 3)
+	got, _, err = zwc.DecoderOptions{MaxScanBytes: int64(len(hidden)), MaxPayloadBytes: 4}.DecodeCarrier(zwc.SpaceCarrier, bytes.NewReader(hidden))
+	if err != nil || string(got) != "data" {
+		t.Error("carrier: Expected data, got", got, err)
+	}
+}
+
+func TestEncodeStreamAndDecodeStream(t *testing.T) {
+	enc := zwc.NewEncoding(2, 5, 32)
+	data := bytes.Repeat([]byte("stream data "), 20000)
+	message := "message"
+
+	// progress is called with the bytes read so far and the total
+	var last, total int64
+	progress := func(done, n int64) {
+		if done < last {
+			t.Error("progress went backwards from", last, "to", done)
+		}
+		last, total = done, n
+	}
+
+	var text bytes.Buffer
+	n, crc, err := zwc.EncodeStream(context.Background(), enc, &text, bytes.NewReader(data),
+		strings.NewReader(message), zwc.StreamOptions{Progress: progress, Jobs: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || last != n || total != n {
+		t.Error("EncodeStream: Expected", len(data), "bytes, got", n, last, total)
+	}
+	if !strings.HasPrefix(text.String(), "m") || !strings.HasSuffix(text.String(), "essage") {
+		t.Error("EncodeStream didn't write the message around the file")
+	}
+	if want := enc.AppendEncode([]byte("m"), data); !bytes.Equal(text.Bytes()[:len(want)], want) {
+		t.Error("EncodeStream didn't match AppendEncode")
+	}
+
+	for _, e := range []*zwc.Encoding{nil, enc} {
+		r := bufio.NewReader(bytes.NewReader(text.Bytes()))
+		if e != nil {
+			if _, err := zwc.DecodeEncodingFromReader(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got bytes.Buffer
+		last = 0
+		n, c, err := zwc.DecodeStream(context.Background(), e, &got, r,
+			zwc.StreamOptions{Progress: progress, Total: int64(text.Len()), Jobs: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), data) || n != int64(len(data)) {
+			t.Error("DecodeStream: Expected", len(data), "bytes, got", n)
+		}
+		if c != crc {
+			t.Errorf("DecodeStream: Expected crc %x, got %x", crc, c)
+		}
+		if total != int64(text.Len()) || last == 0 || last > total {
+			t.Error("DecodeStream: Expected progress up to", total, "got", last)
+		}
+	}
+
+	// an empty file still has a header
+	var empty bytes.Buffer
+	if _, _, err := zwc.EncodeStream(context.Background(), enc, &empty, bytes.NewReader(nil), nil, zwc.StreamOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(zwc.NewDecoder(&empty)); err != nil || len(got) != 0 {
+		t.Error("Expected an empty file, got", got, err)
+	}
+
+	// the streams stop once ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelAfter := zwc.StreamOptions{Progress: func(done, total int64) { cancel() }}
+	_, _, err = zwc.EncodeStream(ctx, enc, io.Discard, iotest.HalfReader(bytes.NewReader(data)), nil, cancelAfter)
+	if !errors.Is(err, context.Canceled) {
+		t.Error("EncodeStream: Expected context.Canceled, got", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancelAfter = zwc.StreamOptions{Progress: func(done, total int64) { cancel() }}
+	_, _, err = zwc.DecodeStream(ctx, nil, io.Discard, iotest.OneByteReader(bytes.NewReader(text.Bytes())), cancelAfter)
+	if !errors.Is(err, context.Canceled) {
+		t.Error("DecodeStream: Expected context.Canceled, got", err)
+	}
+}
+
+// TestRawEncoderAndRawDecoder tests that
+// data written by a raw encoder is read back by a raw decoder,
+// even when the payload is inside a message
+// and the decoder is given one byte at a time
+func TestRawEncoderAndRawDecoder(t *testing.T) {
+	testCases := []struct {
+		encodingType int
+		data         []byte
+	}{
+		{2, []byte("helo")},
+		{3, []byte("longer piece of data")},
+		{4, []byte("longer piece of data")},
+		{4, []byte{}},
+		{5, []byte("longer piece of data")},
+		{5, []byte("helo")},
+		{6, []byte("longer piece of data")},
+		{6, []byte("helo")},
+		{zwc.RadixEncoding, []byte("longer piece of data")},
+		{zwc.RadixEncoding, []byte("helo")},
+	}
+
+	for i, tc := range testCases {
+		version := 1
+		if tc.encodingType >= 5 || tc.encodingType == zwc.RadixEncoding {
+			version = 2
+		}
+		enc := zwc.NewEncoding(version, tc.encodingType, 0)
+
+		var b bytes.Buffer
+		b.WriteString("message ")
+		e := zwc.NewRawEncoder(enc, &b)
+		if _, err := e.Write(tc.data); err != nil {
+			t.Error("testcase", i, ": Write returned an error of", err)
+		}
+		if err := e.Close(); err != nil {
+			t.Error("testcase", i, ": Close returned an error of", err)
+		}
+		b.WriteString("with payload")
+
+		if strings.ContainsRune(b.String(), zwc.V1DelimChar) {
+			t.Error("testcase", i, ": raw payload contains delim char")
+		}
+
+		d := zwc.NewRawDecoder(enc, iotest.OneByteReader(&b))
+		data, err := io.ReadAll(d)
+		if err != nil {
+			t.Error("testcase", i, ": Read returned an error of", err)
+		}
+		if string(data) != string(tc.data) {
+			t.Errorf("Expected %q, got %q", tc.data, data)
+		}
+	}
+
+	// payload which ends part way through a byte
+	enc := zwc.NewEncoding(1, 2, 0)
+	d := zwc.NewRawDecoder(enc, strings.NewReader("\xE2\x80\x8C\xE2\x80\x8D"))
+	if _, err := io.ReadAll(d); err == nil {
+		t.Error("Expected error for incomplete byte")
+	}
+
+	// the rest of the input isn't buffered after invalid utf8
+	r := &readCounter{r: io.MultiReader(strings.NewReader("abc\xff"),
+		bytes.NewReader(bytes.Repeat([]byte("a"), 1<<20)))}
+	var v zwc.CorruptPayloadError
+	if _, err := io.ReadAll(zwc.NewRawDecoder(enc, r)); !errors.Is(err, zwc.ErrInvalidUTF8) ||
+		!errors.As(err, &v) || v.Offset != 3 || v.RuneOffset != 3 {
+		t.Error("Expected invalid utf8 at byte 3, got", err)
+	}
+
+	// offsets are counted from the start of the input, even after earlier reads
+	text := append(bytes.Repeat([]byte(zwc.V1Table[1]), 5000), "\xff"...)
+	_, err := io.ReadAll(zwc.NewRawDecoder(enc, iotest.HalfReader(bytes.NewReader(text))))
+	if !errors.As(err, &v) || v.Offset != 15000 || v.RuneOffset != 5000 {
+		t.Error("Expected invalid utf8 at byte 15000, got", err)
+	}
+	if r.reads > 2 {
+		t.Error("Expected the decoder to stop at invalid utf8, got", r.reads, "reads")
+	}
+}
+
+// TestCustomEncoding tests encoding and decoding
+// with a table containing characters of different lengths
+func TestCustomEncoding(t *testing.T) {
+	table := [16]string{"\u00AD", "\u200B", "\U000E0001", "\u2060",
+			    "\u2061", "\u2062", "\u2063", "\u2064"}
+	delimChar := '\u180E'
+	data := []byte("longer piece of data")
+
+	for _, encodingType := range []int{2, 3} {
+		for _, checksumType := range []int{0, 8, 16, 32} {
+			enc := zwc.NewCustomEncoding(table, delimChar, 1, encodingType, checksumType)
+			dst := make([]byte, enc.EncodedMaxLen(len(data)))
+			n := enc.Encode(dst, data)
+
+			r := bytes.NewReader(dst[:n])
+			v, e, c, err := zwc.DecodeCustomHeaderFromReader(table[:], delimChar, r)
+			if err != nil {
+				t.Error("DecodeCustomHeaderFromReader returned an error of", err)
+			}
+			if v != 1 || e != encodingType || c != checksumType {
+				t.Errorf("Expected 1, %v, %v, got %v, %v, %v",
+						encodingType, checksumType, v, e, c)
+			}
+
+			d := zwc.NewCustomDecoder(zwc.NewCustomEncoding(table, delimChar, v, e, c), r)
+			decoded, err := io.ReadAll(d)
+			if err != nil {
+				t.Error("Read returned an error of", err)
+			}
+			if string(decoded) != string(data) {
+				t.Errorf("Expected %q, got %q", data, decoded)
+			}
+		}
+	}
+}
+
+// TestFiveBitEncoding tests that 5-bit encoding packs
+// groups of 5 bytes into 8 characters across writes and reads
+func TestFiveBitEncoding(t *testing.T) {
+	data := []byte("0123456789abcdef")
+
+	for length := 0; length <= len(data); length++ {
+		for _, checksumType := range []int{0, 8, 16, 32} {
+			enc := zwc.NewEncoding(2, 5, checksumType)
+
+			dst := make([]byte, enc.EncodedMaxLen(length))
+			dst = dst[:enc.Encode(dst, data[:length])]
+
+			// write one byte at a time
+			var b bytes.Buffer
+			e := zwc.NewEncoder(enc, &b)
+			for i := 0; i < length; i++ {
+				if _, err := e.Write(data[i:i+1]); err != nil {
+					t.Error("Write returned an error of", err)
+				}
+			}
+			if length == 0 {
+				e.Write(nil)
+			}
+			if err := e.Close(); err != nil {
+				t.Error("Close returned an error of", err)
+			}
+			if b.String() != string(dst) {
+				t.Errorf("length %v: Expected %q, got %q", length, dst, b.String())
+			}
+
+			// read one byte at a time
+			d := zwc.NewDecoder(iotest.OneByteReader(&b))
+			var decoded []byte
+			p := make([]byte, 1)
+			for {
+				n, err := d.Read(p)
+				decoded = append(decoded, p[:n]...)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Errorf("length %v, checksum %v: Read returned an error of %v",
+							length, checksumType, err)
+					break
+				}
+			}
+			if string(decoded) != string(data[:length]) {
+				t.Errorf("Expected %q, got %q", data[:length], decoded)
+			}
+		}
+	}
+
+	// 5 bytes are encoded as 8 characters
+	enc := zwc.NewEncoding(2, 5, 0)
+	dst := make([]byte, enc.EncodedPayloadMaxLen(5))
+	n := enc.EncodePayload(dst, []byte{0x08, 0x86, 0x42, 0x98, 0xE8})
+	expected := zwc.ExtendedTable[1] + zwc.ExtendedTable[2] + zwc.ExtendedTable[3] +
+		    zwc.ExtendedTable[4] + zwc.ExtendedTable[5] + zwc.ExtendedTable[6] +
+		    zwc.ExtendedTable[7] + zwc.ExtendedTable[8]
+	if string(dst[:n]) != expected {
+		t.Errorf("Expected %q, got %q", expected, dst[:n])
+	}
+
+	// padding bits must be zero
+	src := []byte(zwc.ExtendedTable[0] + zwc.ExtendedTable[1])
+	if _, _, err := enc.DecodePayload(make([]byte, 1), src); err == nil {
+		t.Error("Expected error for non-zero padding")
+	}
+
+	// 3 characters don't end at a byte boundary
+	src = []byte(zwc.ExtendedTable[0] + zwc.ExtendedTable[0] + zwc.ExtendedTable[0])
+	if _, _, err := enc.DecodePayload(make([]byte, 1), src); err == nil {
+		t.Error("Expected error for incomplete byte")
+	}
+
+	// 5-bit encoding requires a version 2 header
+	if err := zwc.ValidEncoding(1, 5, 0); err == nil {
+		t.Error("Expected error for version 1 with encoding 5")
+	}
+}
+
+// TestRadixEncoding tests that base-N encoding
+// works with tables which aren't a power of two
+// across writes and reads
+func TestRadixEncoding(t *testing.T) {
+	table := []string{"\u200B", "\u200C", "\u200D", "\u2060", "\u2061",
+			  "\u2062", "\u2063", "\u2064", "\u206A", "\u206B"}
+	delimChar := '\u034F'
+	data := []byte("0123456789abcdefghij")
+
+	for _, size := range []int{5, 6, 10} {
+		for length := 0; length <= len(data); length++ {
+			enc := zwc.NewCustomTableEncoding(table[:size], delimChar, 2, zwc.RadixEncoding, 16)
+
+			dst := make([]byte, enc.EncodedMaxLen(length))
+			dst = dst[:enc.Encode(dst, data[:length])]
+
+			// write one byte at a time
+			var b bytes.Buffer
+			e := zwc.NewEncoder(enc, &b)
+			e.Write(nil)
+			for i := 0; i < length; i++ {
+				e.Write(data[i:i+1])
+			}
+			if err := e.Close(); err != nil {
+				t.Error("Close returned an error of", err)
+			}
+			if b.String() != string(dst) {
+				t.Errorf("size %v, length %v: Expected %q, got %q", size, length, dst, b.String())
+			}
+
+			r := iotest.OneByteReader(&b)
+			v, et, c, err := zwc.DecodeCustomHeaderFromReader(table[:size], delimChar, r)
+			if err != nil || v != 2 || et != zwc.RadixEncoding || c != 16 {
+				t.Errorf("Expected 2, %v, 16, got %v, %v, %v with error %v",
+						zwc.RadixEncoding, v, et, c, err)
+			}
+
+			// read one byte at a time
+			d := zwc.NewCustomDecoder(zwc.NewCustomTableEncoding(table[:size], delimChar, v, et, c), r)
+			var decoded []byte
+			p := make([]byte, 1)
+			for {
+				n, err := d.Read(p)
+				decoded = append(decoded, p[:n]...)
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Errorf("size %v, length %v: Read returned an error of %v",
+							size, length, err)
+					break
+				}
+			}
+			if string(decoded) != string(data[:length]) {
+				t.Errorf("Expected %q, got %q", data[:length], decoded)
+			}
+		}
+	}
+
+	// 8 bytes are encoded as 20 decimal digits
+	enc := zwc.NewCustomTableEncoding(table, delimChar, 2, zwc.RadixEncoding, 0)
+	if n := enc.EncodedPayloadMaxLen(8); n != 20*3 {
+		t.Errorf("Expected %v, got %v", 20*3, n)
+	}
+	dst := make([]byte, enc.EncodedPayloadMaxLen(2))
+	n := enc.EncodePayload(dst, []byte{0x01, 0x00})
+	expected := table[0] + table[0] + table[2] + table[5] + table[6]
+	if string(dst[:n]) != expected {
+		t.Errorf("Expected %q, got %q", expected, dst[:n])
+	}
+
+	// 1 byte is at most 255
+	src := []byte(table[9] + table[9] + table[9])
+	_, _, err := enc.DecodePayload(make([]byte, 1), src)
+	if v, ok := err.(zwc.CorruptPayloadError); !ok || !v.ChunkOverflow {
+		t.Error("Expected chunk overflow error, got", err)
+	}
+
+	// 2 characters aren't a whole chunk
+	src = []byte(table[0] + table[0])
+	if _, _, err := enc.DecodePayload(make([]byte, 1), src); err == nil {
+		t.Error("Expected error for incomplete byte")
+	}
+
+	// base-N encoding requires a version 2 header
+	if err := zwc.ValidEncoding(1, zwc.RadixEncoding, 0); err == nil {
+		t.Error("Expected error for version 1 with base-N encoding")
+	}
+
+	// each digit must fit in a byte
+	long := make([]string, 257)
+	for i := range long {
+		long[i] = string(rune(0x4E00 + i))
+	}
+	if _, err := zwc.NewCustomTableEncodingE(long[:256], delimChar, 2, zwc.RadixEncoding, 0); err != nil {
+		t.Error("NewCustomTableEncodingE returned an error of", err)
+	}
+	_, err = zwc.NewCustomTableEncodingE(long, delimChar, 2, zwc.RadixEncoding, 0)
+	if v, ok := err.(zwc.InvalidEncodingError); !ok || !v.UnsupportedTable {
+		t.Error("Expected unsupported table error, got", err)
+	}
+	if !errors.Is(err, zwc.ErrUnsupportedTable) {
+		t.Error("Expected ErrUnsupportedTable, got", err)
+	}
+}
+
+// TestNewEncodingE tests that the error-returning constructors
+// return an error instead of panicking
+func TestNewEncodingE(t *testing.T) {
+	testCases := []struct {
+		newEncoding func() (*zwc.Encoding, error)
+		check       func(zwc.InvalidEncodingError) bool
+	}{
+		{func() (*zwc.Encoding, error) { return zwc.NewEncodingE(3, 3, 16) },
+			func(e zwc.InvalidEncodingError) bool { return e.InvalidVersion }},
+		{func() (*zwc.Encoding, error) { return zwc.NewEncodingE(1, 7, 16) },
+			func(e zwc.InvalidEncodingError) bool { return e.InvalidEncodingType }},
+		{func() (*zwc.Encoding, error) { return zwc.NewEncodingE(1, 3, 12) },
+			func(e zwc.InvalidEncodingError) bool { return e.InvalidChecksumType }},
+		{func() (*zwc.Encoding, error) { return zwc.NewEncodingE(1, 5, 16) },
+			func(e zwc.InvalidEncodingError) bool { return e.VersionMismatch }},
+		{func() (*zwc.Encoding, error) { return zwc.NewEncodingE(2, 8, 12) },
+			func(e zwc.InvalidEncodingError) bool { return e.InvalidChecksumType }},
+		{func() (*zwc.Encoding, error) { return zwc.NewEncodingE(1, 6, 16) },
+			func(e zwc.InvalidEncodingError) bool { return e.VersionMismatch }},
+		{func() (*zwc.Encoding, error) { return zwc.NewEncodingE(1, 8, 16) },
+			func(e zwc.InvalidEncodingError) bool { return e.VersionMismatch }},
+		{func() (*zwc.Encoding, error) {
+			return zwc.NewCustomTableEncodingE([]string{"a", "b", "c", "d"}, 'e', 1, 3, 16)
+		},	func(e zwc.InvalidEncodingError) bool { return e.UnsupportedTable }},
+		{func() (*zwc.Encoding, error) { return zwc.NewProfileEncodingE("unknown", 3, 16) },
+			func(e zwc.InvalidEncodingError) bool { return e.InvalidProfile }},
+		{func() (*zwc.Encoding, error) { return zwc.NewProfileEncodingE("conservative", 3, 16) },
+			func(e zwc.InvalidEncodingError) bool { return e.UnsupportedTable }},
+	}
+
+	for i, tc := range testCases {
+		enc, err := tc.newEncoding()
+		if enc != nil {
+			t.Error("testcase", i, ": Expected nil Encoding")
+		}
+		if v, ok := err.(zwc.InvalidEncodingError); !ok || !tc.check(v) {
+			t.Error("testcase", i, ": Unexpected error of", err)
+		}
+	}
+
+	// invalid alphabets wrap the errors from ValidAlphabet
+	_, err := zwc.NewCustomEncodingE([16]string{"a", "b", "a"}, 'e', 1, 2, 16)
+	var v zwc.InvalidEncodingError
+	var a zwc.InvalidAlphabetError
+	if !errors.As(err, &v) || !v.InvalidAlphabet || !errors.Is(err, zwc.ErrInvalidEncoding) {
+		t.Error("Expected InvalidEncodingError, got", err)
+	}
+	if !errors.Is(err, zwc.ErrInvalidAlphabet) || !errors.As(err, &a) || !a.Duplicate || a.Index != 2 {
+		t.Error("Expected InvalidAlphabetError for index 2, got", err)
+	}
+
+	// valid settings
+	if _, err := zwc.NewEncodingE(1, 4, 32); err != nil {
+		t.Error("NewEncodingE returned an error of", err)
+	}
+	if _, err := zwc.NewEncodingE(2, 6, 8); err != nil {
+		t.Error("NewEncodingE returned an error of", err)
+	}
+	if _, err := zwc.NewCustomEncodingE(zwc.V1Table, zwc.V1DelimChar, 1, 4, 0); err != nil {
+		t.Error("NewCustomEncodingE returned an error of", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	enc := zwc.NewEncoding(1, 2, 16)
+	delim := enc.DelimCharAsUTF8()
+	encoded := make([]byte, enc.EncodedMaxLen(5))
+	encoded = encoded[:enc.Encode(encoded, []byte("hello"))]
+
+	// corrupt the last payload character so that the crc fails
+	i := bytes.LastIndex(encoded, delim)
+	corrupt := bytes.Clone(encoded)
+	copy(corrupt[i-3:i], zwc.V1Table[0])
+	if bytes.Equal(corrupt, encoded) {
+		copy(corrupt[i-3:i], zwc.V1Table[1])
+	}
+	// the header ends after the second delim char
+	headerLen := bytes.Index(encoded[len(delim):], delim) + 2*len(delim)
+	headerRunes := len([]rune(string(encoded[:headerLen])))
+	checksumStart := i + len(delim)
+	checksumRune := len([]rune(string(corrupt[:checksumStart])))
+
+	checkCRC := func(name string, err error, offset, runeOffset int) {
+		if !errors.Is(err, zwc.ErrCRCMismatch) || !errors.Is(err, zwc.ErrCorruptPayload) {
+			t.Fatal(name, ": Expected crc mismatch, got", err)
+		}
+		if errors.Is(err, zwc.ErrMissingDelim) || errors.Is(err, zwc.ErrCorruptHeader) {
+			t.Error(name, ": Error matches unrelated sentinel", err)
+		}
+		var v zwc.CorruptPayloadError
+		if !errors.As(err, &v) {
+			t.Fatal(name, ": Expected CorruptPayloadError, got", err)
+		}
+		if v.Offset != checksumStart-offset || v.RuneOffset != checksumRune-runeOffset {
+			t.Errorf("%s: Expected offset %d (%d), got %d (%d)", name,
+				checksumStart-offset, checksumRune-runeOffset, v.Offset, v.RuneOffset)
+		}
+		if v.Expected != enc.CRC([]byte("hello")) || v.Actual == v.Expected {
+			t.Errorf("%s: Unexpected crc values %x and %x", name, v.Expected, v.Actual)
+		}
+	}
+
+	// Decode doesn't take the header so offsets are relative to the payload
+	_, _, err := enc.Decode(make([]byte, 5), corrupt[headerLen:])
+	checkCRC("Decode", err, headerLen, headerRunes)
+
+	_, err = io.ReadAll(zwc.NewDecoder(bytes.NewReader(corrupt)))
+	checkCRC("Decoder", err, 0, 0)
+
+	_, err = io.ReadAll(zwc.NewDecoder(iotest.OneByteReader(bytes.NewReader(corrupt))))
+	checkCRC("Decoder (one byte reader)", err, 0, 0)
+
+	// missing delim is reported at the end of the input
+	noDelim := encoded[:i]
+	_, err = io.ReadAll(zwc.NewDecoder(bytes.NewReader(noDelim)))
+	var v zwc.CorruptPayloadError
+	if !errors.Is(err, zwc.ErrMissingDelim) || !errors.As(err, &v) || v.Offset != len(noDelim) {
+		t.Error("Expected missing delim at", len(noDelim), "got", err)
+	}
+
+	// a payload missing a character has an incomplete byte
+	incomplete := bytes.Clone(encoded[headerLen:i-3])
+	incomplete = append(incomplete, encoded[i:]...)
+	_, _, err = enc.Decode(make([]byte, 5), incomplete)
+	if !errors.Is(err, zwc.ErrIncompleteByte) {
+		t.Error("Expected incomplete byte, got", err)
+	}
+
+	// bytes which aren't valid utf8 in the payload are reported where they are
+	invalid := bytes.Clone(encoded[:i-3])
+	invalid = append(invalid, 0xff)
+	invalid = append(invalid, encoded[i-3:]...)
+	_, _, err = enc.Decode(make([]byte, 5), invalid[headerLen:])
+	if !errors.Is(err, zwc.ErrInvalidUTF8) || !errors.As(err, &v) || v.Offset != i-3-headerLen {
+		t.Error("Decode: Expected invalid utf8 at", i-3-headerLen, "got", err)
+	}
+	_, err = io.ReadAll(zwc.NewDecoder(bytes.NewReader(invalid)))
+	if !errors.Is(err, zwc.ErrInvalidUTF8) || !errors.As(err, &v) || v.Offset != i-3 {
+		t.Error("Decoder: Expected invalid utf8 at", i-3, "got", err)
+	}
+
+	// the message after the checksum doesn't have to be valid utf8
+	latin1 := append(bytes.Clone(encoded), "caf\xe9"...)
+	if _, err := io.ReadAll(zwc.NewDecoder(bytes.NewReader(latin1))); err != nil {
+		t.Error("Decoder: Unexpected error of", err)
+	}
+
+	// header errors are offset by the position of the header
+	shortHeader := "ab" + string(delim) + zwc.V1Table[0] + string(delim)
+	_, _, _, err = zwc.DecodeHeaderFromReader(strings.NewReader(shortHeader))
+	var h zwc.CorruptHeaderError
+	if !errors.Is(err, zwc.ErrShortHeader) || !errors.As(err, &h) ||
+	   h.Offset != 2+len(delim) || h.RuneOffset != 3 {
+		t.Error("Expected short header at", 2+len(delim), "got", err)
+	}
+
+	if err := zwc.ValidEncoding(1, 7, 16); !errors.Is(err, zwc.ErrInvalidEncodingType) ||
+	   !errors.Is(err, zwc.ErrInvalidEncoding) || errors.Is(err, zwc.ErrInvalidVersion) {
+		t.Error("Expected invalid encoding type, got", err)
+	}
+
+	err = zwc.ValidAlphabet([]string{"a", "b", "a", "d"}, 'e')
+	if !errors.Is(err, zwc.ErrDuplicateChar) || !errors.Is(err, zwc.ErrInvalidAlphabet) ||
+	   errors.Is(err, zwc.ErrDelimOverlap) || errors.Is(err, zwc.ErrMissingChar) {
+		t.Error("Expected duplicate character, got", err)
+	}
+	err = zwc.ValidAlphabet([]string{"a", "b", "c", ""}, 'c')
+	if !errors.Is(err, zwc.ErrDelimOverlap) || !errors.Is(err, zwc.ErrMissingChar) {
+		t.Error("Expected delim overlap and missing character, got", err)
+	}
+
+	if _, _, err := zwc.SpaceCarrier.Decode([]byte("no spaces")); !errors.Is(err, zwc.ErrNotFound) ||
+	   !errors.Is(err, zwc.ErrCarrier) {
+		t.Error("Expected not found, got", err)
+	}
+}
+
+func TestValidAlphabet(t *testing.T) {
+	testCases := []struct {
+		table     []string
+		delimChar rune
+		expected  []zwc.InvalidAlphabetError
+	}{
+		{zwc.V1Table[:], zwc.V1DelimChar, nil},
+		{zwc.ExtendedTable[:], zwc.V1DelimChar, nil},
+		{[]string{"a", "b", "c", "d"}, 'e', nil},
+		{[]string{"a", "b", "c", ""}, 'e',
+			[]zwc.InvalidAlphabetError{{Index: 3, Missing: true}}},
+		{[]string{"a", "b", "c", "d", "", "f"}, 'e',
+			[]zwc.InvalidAlphabetError{{Index: 4, Missing: true}}},
+		{[]string{"a", "b", "a", "ab"}, 'b',
+			[]zwc.InvalidAlphabetError{{Index: 1, DelimOverlap: true},
+						   {Index: 2, Duplicate: true},
+						   {Index: 3, InvalidChar: true}}},
+		{[]string{"a", "b"}, 'e',
+			[]zwc.InvalidAlphabetError{{Index: 2, Missing: true},
+						   {Index: 3, Missing: true}}},
+		{[]string{"a", "b", "c", "\xff"}, -1,
+			[]zwc.InvalidAlphabetError{{InvalidDelim: true},
+						   {Index: 3, InvalidChar: true}}},
+	}
+
+	for i, tc := range testCases {
+		err := zwc.ValidAlphabet(tc.table, tc.delimChar)
+		if tc.expected == nil {
+			if err != nil {
+				t.Error("testcase", i, ": Expected nil, got", err)
+			}
+			continue
+		}
+
+		errs := err.(interface{ Unwrap() []error }).Unwrap()
+		if len(errs) != len(tc.expected) {
+			t.Errorf("testcase %v: Expected %v errors, got %v", i, len(tc.expected), errs)
+			continue
+		}
+		for j, e := range errs {
+			if e != tc.expected[j] {
+				t.Errorf("testcase %v: Expected %v, got %v", i, tc.expected[j], e)
+			}
+		}
+	}
+}
+
+// readCounter counts the calls to Read
+type readCounter struct {
+	r     io.Reader
+	reads int
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
+func TestDecodeHeaderFromReaderBuffering(t *testing.T) {
+	enc := zwc.NewEncoding(1, 3, 16)
+	message := bytes.Repeat([]byte("a long message before the header "), 10000)
+	file := enc.AppendEncode(nil, []byte("hello"))
+	src := append(append([]byte(nil), message...), file...)
+
+	// readers which aren't io.RuneReaders are read until the end of the header
+	r := bytes.NewReader(src)
+	decoded, err := zwc.DecodeEncodingFromReader(struct{ io.Reader }{r})
+	if err != nil || decoded.EncodingType() != 3 {
+		t.Fatal("DecodeEncodingFromReader returned", decoded, err)
+	}
+	delim := enc.DelimCharAsUTF8()
+	afterHeader := len(file) - bytes.Index(file[len(delim):], delim) - 2*len(delim)
+	if r.Len() != afterHeader {
+		t.Error("Expected", afterHeader, "bytes after the header, got", r.Len())
+	}
+
+	// a bufio.Reader can be passed to NewCustomDecoder after the header
+	br := bufio.NewReader(bytes.NewReader(src))
+	if _, _, _, err := zwc.DecodeHeaderFromReader(br); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zwc.NewCustomDecoder(enc, br))
+	if err != nil || string(data) != "hello" {
+		t.Error("Expected hello, got", string(data), err)
+	}
+
+	// NewDecoder reads in large blocks
+	counter := &readCounter{r: bytes.NewReader(src)}
+	data, err = io.ReadAll(zwc.NewDecoder(counter))
+	if err != nil || string(data) != "hello" {
+		t.Error("Expected hello, got", string(data), err)
+	}
+	if counter.reads > len(src)/4096 {
+		t.Error("NewDecoder read", len(src), "bytes with", counter.reads, "reads")
+	}
+}
+
 func TestGuessEncodingType(t *testing.T) {
 	testCases := []struct {
 		payload  []byte
@@ -807,6 +2051,82 @@ func TestGuessEncodingType(t *testing.T) {
 	}
 }
 
+// TestDetectEncoding tests that DetectEncoding
+// ranks the encoding used to encode the data first
+func TestDetectEncoding(t *testing.T) {
+	testCases := []struct {
+		encodingType int
+		checksumType int
+		data         []byte
+	}{
+		{2, 8, []byte("helo")},
+		{2, 32, []byte("longer piece of data")},
+		{3, 16, []byte("longer piece of data")},
+		{4, 8, []byte("longer piece of data")},
+		{4, 32, []byte("helo")},
+	}
+
+	for i, tc := range testCases {
+		enc := zwc.NewEncoding(1, tc.encodingType, tc.checksumType)
+		dst := make([]byte, enc.EncodedMaxLen(len(tc.data)))
+		n := enc.Encode(dst, tc.data)
+
+		// skip the file signature, header, and delim
+		header := 2 + enc.EncodedHeaderLen() + 2
+		candidates := zwc.DetectEncoding(dst[header:n])
+
+		if len(candidates) == 0 {
+			t.Error("testcase", i, ": no candidates returned")
+			continue
+		}
+		c := candidates[0]
+		if c.EncodingType != tc.encodingType || c.ChecksumType != tc.checksumType {
+			t.Errorf("testcase %v: Expected %v, %v, got %v, %v", i,
+					tc.encodingType, tc.checksumType,
+					c.EncodingType, c.ChecksumType)
+		}
+		if !c.CRCMatch {
+			t.Error("testcase", i, ": Expected crc to match")
+		}
+
+		// matching candidates are ranked by checksum strength,
+		// then by the number of characters which aren't in the table
+		for j := 1; j < len(candidates); j++ {
+			a, b := candidates[j-1], candidates[j]
+			if !a.CRCMatch && b.CRCMatch || a.CRCMatch && b.CRCMatch &&
+				(a.ChecksumType < b.ChecksumType ||
+					a.ChecksumType == b.ChecksumType && a.InvalidChars > b.InvalidChars) {
+				t.Errorf("testcase %v: %+v is ranked before %+v", i, a, b)
+			}
+		}
+	}
+
+	// the payload of "data 10" also matches base-N encoding with crc-8 by chance,
+	// which is ranked after the crc-32 match
+	enc32 := zwc.NewEncoding(1, 3, 32)
+	encoded := enc32.AppendEncode(nil, []byte("data 10"))
+	candidates := zwc.DetectEncoding(encoded[2+enc32.EncodedHeaderLen()+2:])
+	var weak bool
+	for _, c := range candidates {
+		weak = weak || c.CRCMatch && c.ChecksumType == 8
+	}
+	if !weak || len(candidates) == 0 || candidates[0].EncodingType != 3 || candidates[0].ChecksumType != 32 {
+		t.Errorf("Expected 3, 32 before a crc-8 match, got %+v", candidates)
+	}
+
+	// payload without checksum can only be guessed
+	enc := zwc.NewEncoding(1, 4, 0)
+	dst := make([]byte, enc.EncodedMaxLen(4))
+	n := enc.Encode(dst, []byte("helo"))
+	candidates = zwc.DetectEncoding(dst[2+enc.EncodedHeaderLen()+2:n])
+	if len(candidates) == 0 {
+		t.Fatal("no candidates returned")
+	}
+	if c := candidates[0]; c.EncodingType != 4 || c.ChecksumType != 0 || c.CRCMatch {
+		t.Errorf("Expected unverified 4, 0, got %+v", c)
+	}
+}
+
 func TestCRC2(t *testing.T) {
 	// this table was automatically generated
 	expected := [256]byte{0, 1, 2, 3, 3, 2, 1, 0, 1, 0, 3, 2, 2, 3, 0, 1,
@@ -911,3 +2231,95 @@ func TestCRCs(t *testing.T) {
 		}
 	}
 }
+
+// benchmarkEncodings are the encodings used by the benchmarks
+var benchmarkEncodings = []struct {
+	name string
+	enc  *zwc.Encoding
+}{
+	{"2-bit", zwc.NewEncoding(1, 2, 32)},
+	{"4-bit", zwc.NewEncoding(1, 4, 32)},
+	{"5-bit", zwc.NewEncoding(2, 5, 32)},
+	{"variation-selectors", zwc.NewVariationSelectorEncoding(32)},
+	{"tags", zwc.NewTagEncoding(32)},
+}
+
+// benchmarkData returns 1 MiB of data
+func benchmarkData() []byte {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func BenchmarkEncode(b *testing.B) {
+	data := benchmarkData()
+	for _, bc := range benchmarkEncodings {
+		b.Run(bc.name, func(b *testing.B) {
+			dst := make([]byte, bc.enc.EncodedMaxLen(len(data)))
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				bc.enc.Encode(dst, data)
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data := benchmarkData()
+	for _, bc := range benchmarkEncodings {
+		b.Run(bc.name, func(b *testing.B) {
+			src := bc.enc.AppendEncode(nil, data)
+			dst := make([]byte, 0, len(src))
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := zwc.AppendDecode(dst, src); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	data := benchmarkData()
+	for _, bc := range benchmarkEncodings {
+		b.Run(bc.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				encoder := zwc.NewEncoder(bc.enc, io.Discard)
+				// write in pieces like io.Copy would
+				for p := data; len(p) > 0; p = p[32*1024:] {
+					encoder.Write(p[:32*1024])
+				}
+				encoder.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	data := benchmarkData()
+	for _, bc := range benchmarkEncodings {
+		b.Run(bc.name, func(b *testing.B) {
+			src := bc.enc.AppendEncode(nil, data)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// io.Copy uses WriteTo
+				decoder := zwc.NewDecoder(bytes.NewReader(src))
+				if _, err := io.Copy(io.Discard, decoder); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}